@@ -0,0 +1,4 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS products_created_at_idx ON products (created_at, id);
+CREATE INDEX IF NOT EXISTS products_price_idx ON products (price, id);
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+DROP INDEX IF EXISTS products_category_id_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS categories (
+    id UUID PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    slug VARCHAR UNIQUE NOT NULL,
+    parent_id UUID REFERENCES categories(id),
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id UUID REFERENCES categories(id);
+CREATE INDEX IF NOT EXISTS products_category_id_idx ON products (category_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;
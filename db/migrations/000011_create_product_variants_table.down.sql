@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS product_variants_refresh_product_trigger ON product_variants;
+DROP FUNCTION IF EXISTS product_variants_refresh_product();
+DROP TRIGGER IF EXISTS products_variant_aggregate_trigger ON products;
+DROP FUNCTION IF EXISTS products_variant_aggregate();
+DROP INDEX IF EXISTS products_min_price_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS max_price;
+ALTER TABLE products DROP COLUMN IF EXISTS min_price;
+ALTER TABLE payments DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS product_variants;
@@ -0,0 +1,70 @@
+CREATE TABLE IF NOT EXISTS product_variants (
+    id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR NOT NULL,
+    options JSONB NOT NULL,
+    price INTEGER,
+    stock INTEGER NOT NULL,
+    image_url VARCHAR,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (product_id, sku),
+    UNIQUE (product_id, options)
+);
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS variant_id UUID REFERENCES product_variants(id);
+
+-- price range and stock of a product are aggregated over its variants, a
+-- product without variants has its own price as range
+ALTER TABLE products ADD COLUMN IF NOT EXISTS min_price INTEGER;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS max_price INTEGER;
+UPDATE products SET min_price = price, max_price = price;
+ALTER TABLE products ALTER COLUMN min_price SET NOT NULL;
+ALTER TABLE products ALTER COLUMN max_price SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS products_min_price_idx ON products (min_price, id);
+
+CREATE OR REPLACE FUNCTION products_variant_aggregate() RETURNS trigger AS $$
+DECLARE
+    agg RECORD;
+BEGIN
+    SELECT
+        count(v.id) AS variants,
+        min(COALESCE(v.price, NEW.price)) AS min_price,
+        max(COALESCE(v.price, NEW.price)) AS max_price,
+        sum(v.stock) AS stock
+    INTO agg
+    FROM product_variants v WHERE v.product_id = NEW.id;
+
+    IF agg.variants > 0 THEN
+        NEW.min_price := agg.min_price;
+        NEW.max_price := agg.max_price;
+        NEW.stock := agg.stock;
+    ELSE
+        NEW.min_price := NEW.price;
+        NEW.max_price := NEW.price;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS products_variant_aggregate_trigger ON products;
+CREATE TRIGGER products_variant_aggregate_trigger
+    BEFORE INSERT OR UPDATE ON products
+    FOR EACH ROW EXECUTE FUNCTION products_variant_aggregate();
+
+-- touching the product reruns the aggregate above
+CREATE OR REPLACE FUNCTION product_variants_refresh_product() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE products SET id = id WHERE id = OLD.product_id;
+        RETURN OLD;
+    END IF;
+    UPDATE products SET id = id WHERE id = NEW.product_id;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS product_variants_refresh_product_trigger ON product_variants;
+CREATE TRIGGER product_variants_refresh_product_trigger
+    AFTER INSERT OR UPDATE OR DELETE ON product_variants
+    FOR EACH ROW EXECUTE FUNCTION product_variants_refresh_product();
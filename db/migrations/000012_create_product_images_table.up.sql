@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS uploaded_images (
+    url VARCHAR PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS product_images (
+    id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    url VARCHAR NOT NULL,
+    alt_text VARCHAR NOT NULL DEFAULT '',
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS product_images_product_id_idx ON product_images (product_id, position);
+
+INSERT INTO product_images (id, product_id, url, position)
+SELECT gen_random_uuid(), id, image_url, 0 FROM products;
@@ -0,0 +1,41 @@
+-- every stock change is appended here, the stock of a product without
+-- variants is the sum of its rows without variant_id and the stock of a
+-- variant is the sum of its rows
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID,
+    quantity INTEGER NOT NULL,
+    reason VARCHAR NOT NULL,
+    note VARCHAR NOT NULL DEFAULT '',
+    stock_after INTEGER NOT NULL,
+    payment_id UUID REFERENCES payments(id),
+    user_id UUID REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS inventory_movements_product_id_idx ON inventory_movements (product_id, created_at);
+
+-- the ledger is append-only, rows only go away with their product
+CREATE OR REPLACE FUNCTION inventory_movements_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND pg_trigger_depth() > 1 THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'inventory_movements is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS inventory_movements_append_only_trigger ON inventory_movements;
+CREATE TRIGGER inventory_movements_append_only_trigger
+    BEFORE UPDATE OR DELETE ON inventory_movements
+    FOR EACH ROW EXECUTE FUNCTION inventory_movements_append_only();
+
+INSERT INTO inventory_movements (id, product_id, quantity, reason, stock_after, user_id)
+SELECT gen_random_uuid(), p.id, p.stock, 'initial', p.stock, p.user_id
+FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id);
+
+INSERT INTO inventory_movements (id, product_id, variant_id, quantity, reason, stock_after, user_id)
+SELECT gen_random_uuid(), v.product_id, v.id, v.stock, 'initial', v.stock, p.user_id
+FROM product_variants v JOIN products p ON p.id = v.product_id;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS import_jobs;
+DROP INDEX IF EXISTS products_user_id_sku_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS sku;
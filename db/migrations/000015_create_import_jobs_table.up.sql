@@ -0,0 +1,20 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR;
+
+CREATE UNIQUE INDEX IF NOT EXISTS products_user_id_sku_idx ON products (user_id, sku) WHERE sku IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    format VARCHAR NOT NULL,
+    mode VARCHAR NOT NULL,
+    status VARCHAR NOT NULL,
+    total_rows INTEGER NOT NULL DEFAULT 0,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    succeeded_rows INTEGER NOT NULL DEFAULT 0,
+    failed_rows INTEGER NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS import_jobs_user_id_idx ON import_jobs (user_id, created_at);
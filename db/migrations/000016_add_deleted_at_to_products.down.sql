@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS products_user_id_sku_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS products_user_id_sku_idx ON products (user_id, sku) WHERE sku IS NOT NULL;
+
+DROP INDEX IF EXISTS products_deleted_at_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
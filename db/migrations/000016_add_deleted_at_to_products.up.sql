@@ -0,0 +1,7 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS products_deleted_at_idx ON products (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- an archived product gives its sku back to the catalogue
+DROP INDEX IF EXISTS products_user_id_sku_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS products_user_id_sku_idx ON products (user_id, sku) WHERE sku IS NOT NULL AND deleted_at IS NULL;
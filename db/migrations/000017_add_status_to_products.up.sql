@@ -0,0 +1,10 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'published';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS unpublish_at TIMESTAMPTZ;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_status_check;
+ALTER TABLE products ADD CONSTRAINT products_status_check CHECK (status IN ('draft', 'published', 'scheduled', 'unlisted'));
+
+CREATE INDEX IF NOT EXISTS products_status_idx ON products (status);
+CREATE INDEX IF NOT EXISTS products_publish_at_idx ON products (publish_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS products_unpublish_at_idx ON products (unpublish_at) WHERE unpublish_at IS NOT NULL;
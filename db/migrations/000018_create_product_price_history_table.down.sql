@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS products_price_history_trigger ON products;
+DROP FUNCTION IF EXISTS products_price_history();
+DROP TABLE IF EXISTS product_price_history;
+
+ALTER TABLE payments DROP COLUMN IF EXISTS unit_price;
+
+ALTER TABLE products DROP COLUMN IF EXISTS sale_ends_at;
+ALTER TABLE products DROP COLUMN IF EXISTS sale_starts_at;
+ALTER TABLE products DROP COLUMN IF EXISTS sale_price;
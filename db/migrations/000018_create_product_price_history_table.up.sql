@@ -0,0 +1,40 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_price INTEGER;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_starts_at TIMESTAMPTZ;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_ends_at TIMESTAMPTZ;
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS unit_price INTEGER;
+
+CREATE TABLE IF NOT EXISTS product_price_history (
+    id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price INTEGER NOT NULL,
+    sale_price INTEGER,
+    sale_starts_at TIMESTAMPTZ,
+    sale_ends_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS product_price_history_product_id_idx ON product_price_history (product_id, created_at);
+
+-- every change of the price or the sale of a product is kept
+CREATE OR REPLACE FUNCTION products_price_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT'
+        OR NEW.price IS DISTINCT FROM OLD.price
+        OR NEW.sale_price IS DISTINCT FROM OLD.sale_price
+        OR NEW.sale_starts_at IS DISTINCT FROM OLD.sale_starts_at
+        OR NEW.sale_ends_at IS DISTINCT FROM OLD.sale_ends_at THEN
+        INSERT INTO product_price_history (id, product_id, price, sale_price, sale_starts_at, sale_ends_at)
+        VALUES (gen_random_uuid(), NEW.id, NEW.price, NEW.sale_price, NEW.sale_starts_at, NEW.sale_ends_at);
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS products_price_history_trigger ON products;
+CREATE TRIGGER products_price_history_trigger
+    AFTER INSERT OR UPDATE ON products
+    FOR EACH ROW EXECUTE FUNCTION products_price_history();
+
+INSERT INTO product_price_history (id, product_id, price, created_at)
+SELECT gen_random_uuid(), id, price, created_at FROM products;
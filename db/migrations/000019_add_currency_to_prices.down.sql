@@ -0,0 +1,31 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
+ALTER TABLE payments DROP COLUMN IF EXISTS total;
+ALTER TABLE payments ALTER COLUMN unit_price TYPE INTEGER;
+
+CREATE OR REPLACE FUNCTION products_price_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT'
+        OR NEW.price IS DISTINCT FROM OLD.price
+        OR NEW.sale_price IS DISTINCT FROM OLD.sale_price
+        OR NEW.sale_starts_at IS DISTINCT FROM OLD.sale_starts_at
+        OR NEW.sale_ends_at IS DISTINCT FROM OLD.sale_ends_at THEN
+        INSERT INTO product_price_history (id, product_id, price, sale_price, sale_starts_at, sale_ends_at)
+        VALUES (gen_random_uuid(), NEW.id, NEW.price, NEW.sale_price, NEW.sale_starts_at, NEW.sale_ends_at);
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE product_price_history DROP COLUMN IF EXISTS currency;
+ALTER TABLE product_price_history
+    ALTER COLUMN price TYPE INTEGER,
+    ALTER COLUMN sale_price TYPE INTEGER;
+
+ALTER TABLE product_variants ALTER COLUMN price TYPE INTEGER;
+
+ALTER TABLE products
+    ALTER COLUMN price TYPE INTEGER,
+    ALTER COLUMN sale_price TYPE INTEGER,
+    ALTER COLUMN min_price TYPE INTEGER,
+    ALTER COLUMN max_price TYPE INTEGER;
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,42 @@
+-- amounts are stored in the minor unit of the currency of the product
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'IDR';
+ALTER TABLE products
+    ALTER COLUMN price TYPE BIGINT,
+    ALTER COLUMN sale_price TYPE BIGINT,
+    ALTER COLUMN min_price TYPE BIGINT,
+    ALTER COLUMN max_price TYPE BIGINT;
+
+ALTER TABLE product_variants ALTER COLUMN price TYPE BIGINT;
+
+ALTER TABLE product_price_history
+    ALTER COLUMN price TYPE BIGINT,
+    ALTER COLUMN sale_price TYPE BIGINT;
+ALTER TABLE product_price_history ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE product_price_history SET currency = products.currency FROM products WHERE products.id = product_price_history.product_id;
+ALTER TABLE product_price_history ALTER COLUMN currency SET NOT NULL;
+
+CREATE OR REPLACE FUNCTION products_price_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT'
+        OR NEW.price IS DISTINCT FROM OLD.price
+        OR NEW.currency IS DISTINCT FROM OLD.currency
+        OR NEW.sale_price IS DISTINCT FROM OLD.sale_price
+        OR NEW.sale_starts_at IS DISTINCT FROM OLD.sale_starts_at
+        OR NEW.sale_ends_at IS DISTINCT FROM OLD.sale_ends_at THEN
+        INSERT INTO product_price_history (id, product_id, price, currency, sale_price, sale_starts_at, sale_ends_at)
+        VALUES (gen_random_uuid(), NEW.id, NEW.price, NEW.currency, NEW.sale_price, NEW.sale_starts_at, NEW.sale_ends_at);
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- payments keep what was paid at the time of the purchase, payments made
+-- before the unit price was recorded are priced at the current price
+ALTER TABLE payments ALTER COLUMN unit_price TYPE BIGINT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS total BIGINT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE payments SET
+    unit_price = COALESCE(payments.unit_price, (SELECT v.price FROM product_variants v WHERE v.id = payments.variant_id), products.price),
+    currency = products.currency
+FROM products WHERE products.id = payments.product_id;
+UPDATE payments SET total = unit_price * quantity;
@@ -0,0 +1,3 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS order_id;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS cart_items;
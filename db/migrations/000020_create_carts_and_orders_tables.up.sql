@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS cart_items (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- a product (or variant) is in the cart once, adding it again adds to its quantity
+CREATE UNIQUE INDEX IF NOT EXISTS cart_items_user_id_product_idx
+    ON cart_items (user_id, product_id, COALESCE(variant_id, '00000000-0000-0000-0000-000000000000'));
+
+-- a checkout creates one order per seller, the payments of the order are
+-- paid with a single transfer to the bank account of the seller
+CREATE TABLE IF NOT EXISTS orders (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    seller_id UUID NOT NULL REFERENCES users(id),
+    bank_account_id UUID NOT NULL REFERENCES bank_accounts(id),
+    payment_proof_image_url VARCHAR NOT NULL,
+    total BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id, created_at);
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS order_id UUID REFERENCES orders(id);
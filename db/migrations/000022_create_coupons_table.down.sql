@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS payments_coupon_id_idx;
+ALTER TABLE payments DROP COLUMN IF EXISTS discount;
+ALTER TABLE payments DROP COLUMN IF EXISTS coupon_code;
+ALTER TABLE payments DROP COLUMN IF EXISTS coupon_id;
+DROP TABLE IF EXISTS coupons;
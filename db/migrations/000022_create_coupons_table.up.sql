@@ -0,0 +1,29 @@
+-- coupons without a seller are platform coupons and apply to every product
+CREATE TABLE IF NOT EXISTS coupons (
+    id UUID PRIMARY KEY,
+    code VARCHAR(32) NOT NULL,
+    seller_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('percentage', 'fixed', 'free_quantity')),
+    -- a percentage, an amount in minor units of currency or a number of free items
+    value BIGINT NOT NULL CHECK (value > 0),
+    currency CHAR(3),
+    min_quantity INTEGER NOT NULL DEFAULT 1,
+    product_ids UUID[] NOT NULL DEFAULT '{}',
+    tags VARCHAR[] NOT NULL DEFAULT '{}',
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    usage_limit INTEGER,
+    per_user_limit INTEGER,
+    usage_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS coupons_code_idx ON coupons (code) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS coupons_seller_id_idx ON coupons (seller_id, created_at);
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS coupon_id UUID REFERENCES coupons(id);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(32);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS discount BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS payments_coupon_id_idx ON payments (coupon_id, user_id);
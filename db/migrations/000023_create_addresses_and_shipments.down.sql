@@ -0,0 +1,12 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS closed_at;
+
+DROP INDEX IF EXISTS payments_user_id_idx;
+ALTER TABLE payments DROP COLUMN IF EXISTS created_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS received_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS shipped_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS tracking_number;
+ALTER TABLE payments DROP COLUMN IF EXISTS carrier;
+ALTER TABLE payments DROP COLUMN IF EXISTS status;
+ALTER TABLE payments DROP COLUMN IF EXISTS shipping_address;
+
+DROP TABLE IF EXISTS addresses;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    label VARCHAR(30) NOT NULL DEFAULT '',
+    recipient_name VARCHAR(60) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    street VARCHAR(255) NOT NULL,
+    city VARCHAR(60) NOT NULL,
+    region VARCHAR(60) NOT NULL DEFAULT '',
+    postal_code VARCHAR(10) NOT NULL,
+    country CHAR(2) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS addresses_user_id_idx ON addresses (user_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_default_idx ON addresses (user_id) WHERE is_default;
+
+-- payments keep a copy of the address, editing the address book does not
+-- change where a purchase is shipped
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS shipping_address JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'paid' CHECK (status IN ('paid', 'shipped', 'received'));
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS carrier VARCHAR(30);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS tracking_number VARCHAR(60);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS shipped_at TIMESTAMPTZ;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS received_at TIMESTAMPTZ;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS payments_user_id_idx ON payments (user_id, created_at);
+
+-- an order is closed once the buyer received all of its payments
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS closed_at TIMESTAMPTZ;
@@ -0,0 +1,11 @@
+ALTER TABLE users DROP COLUMN IF EXISTS rating_average;
+ALTER TABLE users DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE users DROP COLUMN IF EXISTS rating_sum;
+
+DROP INDEX IF EXISTS products_rating_average_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS rating_average;
+ALTER TABLE products DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE products DROP COLUMN IF EXISTS rating_sum;
+
+DROP TABLE IF EXISTS review_reports;
+DROP TABLE IF EXISTS reviews;
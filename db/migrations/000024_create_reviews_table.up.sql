@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS reviews (
+    id UUID PRIMARY KEY,
+    -- a review is left once per purchase
+    payment_id UUID NOT NULL UNIQUE REFERENCES payments(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    body TEXT NOT NULL DEFAULT '',
+    reply TEXT,
+    replied_at TIMESTAMPTZ,
+    -- hidden reviews are left out of listings and of the rating aggregates
+    status VARCHAR(16) NOT NULL DEFAULT 'visible' CHECK (status IN ('visible', 'hidden')),
+    -- reports since the review was last moderated
+    report_count INTEGER NOT NULL DEFAULT 0,
+    moderated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS reviews_product_id_idx ON reviews (product_id, created_at) WHERE status = 'visible';
+CREATE INDEX IF NOT EXISTS reviews_reported_idx ON reviews (report_count DESC, created_at) WHERE report_count > 0;
+
+CREATE TABLE IF NOT EXISTS review_reports (
+    review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (review_id, user_id)
+);
+
+-- the sum and count of the visible ratings are kept up to date as reviews
+-- change, the average is derived from them
+ALTER TABLE products ADD COLUMN IF NOT EXISTS rating_sum BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS rating_average NUMERIC(3, 2)
+    GENERATED ALWAYS AS (CASE WHEN rating_count = 0 THEN 0 ELSE round(rating_sum::numeric / rating_count, 2) END) STORED;
+
+CREATE INDEX IF NOT EXISTS products_rating_average_idx ON products (rating_average, id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_sum BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_average NUMERIC(3, 2)
+    GENERATED ALWAYS AS (CASE WHEN rating_count = 0 THEN 0 ELSE round(rating_sum::numeric / rating_count, 2) END) STORED;
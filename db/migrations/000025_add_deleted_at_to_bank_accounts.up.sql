@@ -0,0 +1,10 @@
+-- bank accounts of deleted users are kept for their payments but can no
+-- longer be paid to
+ALTER TABLE bank_accounts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- products of users deleted before this migration were only made
+-- unpurchasable, they are archived like the products of users deleted now
+UPDATE products SET deleted_at = users.deleted_at, version = version + 1
+FROM users WHERE users.id = products.user_id AND users.deleted_at IS NOT NULL AND products.deleted_at IS NULL;
+UPDATE bank_accounts SET deleted_at = users.deleted_at
+FROM users WHERE users.id = bank_accounts.user_id AND users.deleted_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- sessions outlive their access tokens, clients trade the refresh token for
+-- a new access token. Only a hash of the token is stored.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS refresh_token_hash VARCHAR;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_refresh_token_hash_idx ON sessions (refresh_token_hash);
@@ -0,0 +1,26 @@
+package domain
+
+type Address struct {
+	ID            string `json:"addressId"`
+	Label         string `json:"label" validate:"max=30"`
+	RecipientName string `json:"recipientName" validate:"required,min=2,max=60"`
+	Phone         string `json:"phone" validate:"required,e164"`
+	Street        string `json:"street" validate:"required,max=255"`
+	City          string `json:"city" validate:"required,max=60"`
+	Region        string `json:"region" validate:"max=60"`
+	PostalCode    string `json:"postalCode" validate:"required,max=10"`
+	Country       string `json:"country" validate:"required,iso3166_1_alpha2"`
+	IsDefault     bool   `json:"isDefault"`
+}
+
+type AddressUpdate struct {
+	Label         *string `json:"label" validate:"omitempty,max=30"`
+	RecipientName *string `json:"recipientName" validate:"omitempty,min=2,max=60"`
+	Phone         *string `json:"phone" validate:"omitempty,e164"`
+	Street        *string `json:"street" validate:"omitempty,max=255"`
+	City          *string `json:"city" validate:"omitempty,max=60"`
+	Region        *string `json:"region" validate:"omitempty,max=60"`
+	PostalCode    *string `json:"postalCode" validate:"omitempty,max=10"`
+	Country       *string `json:"country" validate:"omitempty,iso3166_1_alpha2"`
+	IsDefault     *bool   `json:"isDefault"`
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+const (
+	ScopeProductsRead      = "products:read"
+	ScopeProductsWrite     = "products:write"
+	ScopeStockRead         = "stock:read"
+	ScopeStockWrite        = "stock:write"
+	ScopePaymentsRead      = "payments:read"
+	ScopePaymentsWrite     = "payments:write"
+	ScopeBankAccountsRead  = "bank_accounts:read"
+	ScopeBankAccountsWrite = "bank_accounts:write"
+	ScopeImagesWrite       = "images:write"
+)
+
+type ApiKey struct {
+	ID         string     `json:"apiKeyId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+type ApiKeyCreate struct {
+	Name   string   `json:"name" validate:"required,min=3,max=50"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=products:read products:write stock:read stock:write payments:read payments:write bank_accounts:read bank_accounts:write images:write"`
+}
+
+// ApiKeyCreated is only returned once, the plain key is never stored.
+type ApiKeyCreated struct {
+	ApiKey
+	Key string `json:"key"`
+}
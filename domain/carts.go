@@ -0,0 +1,46 @@
+package domain
+
+type CartItem struct {
+	ProductId string  `json:"productId" validate:"required,uuid"`
+	VariantId *string `json:"variantId" validate:"omitempty,uuid"`
+	Quantity  *int64  `json:"quantity" validate:"required,min=1"`
+}
+
+type CartItemUpdate struct {
+	Quantity *int64 `json:"quantity" validate:"required,min=1"`
+}
+
+type CartItemData struct {
+	ID            string            `json:"cartItemId"`
+	ProductId     string            `json:"productId"`
+	VariantId     *string           `json:"variantId"`
+	Options       map[string]string `json:"options,omitempty"`
+	SellerId      string            `json:"sellerId"`
+	Name          string            `json:"name"`
+	ImageUrl      string            `json:"imageUrl"`
+	Quantity      int64             `json:"quantity"`
+	Stock         int64             `json:"stock"`
+	IsPurchasable bool              `json:"isPurchasable"`
+	UnitPrice     Money             `json:"unitPrice"`
+	Subtotal      Money             `json:"subtotal"`
+}
+
+// Cart totals are summed per currency, amounts of different currencies are
+// never added up.
+type Cart struct {
+	Items  []CartItemData `json:"items"`
+	Totals []Money        `json:"totals"`
+}
+
+// Checkout pays the cart with one order per seller, every seller in the cart
+// is paid to one of their bank accounts.
+type Checkout struct {
+	Orders []CheckoutOrder `json:"orders" validate:"required,min=1,dive"`
+	// AddressId defaults to the default address of the buyer.
+	AddressId *string `json:"addressId" validate:"omitempty,uuid"`
+}
+
+type CheckoutOrder struct {
+	BankAccountId        string `json:"bankAccountId" validate:"required,uuid"`
+	PaymentProofImageUrl string `json:"paymentProofImageUrl" validate:"required,url"`
+}
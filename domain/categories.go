@@ -0,0 +1,21 @@
+package domain
+
+type Category struct {
+	ID       string      `json:"categoryId"`
+	Name     string      `json:"name"`
+	Slug     string      `json:"slug"`
+	ParentId *string     `json:"parentId"`
+	Children []*Category `json:"children"`
+}
+
+type CategoryRequest struct {
+	Name     string  `json:"name" validate:"required,min=2,max=50"`
+	Slug     string  `json:"slug" validate:"required,min=2,max=50,slug"`
+	ParentId *string `json:"parentId" validate:"omitempty,uuid"`
+}
+
+type Breadcrumb struct {
+	ID   string `json:"categoryId"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
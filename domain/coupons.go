@@ -0,0 +1,49 @@
+package domain
+
+import "time"
+
+const (
+	CouponPercentage   = "percentage"
+	CouponFixed        = "fixed"
+	CouponFreeQuantity = "free_quantity"
+)
+
+// Coupon Value is a percentage, an amount in minor units of Currency or, for
+// free_quantity, the number of free items for every MinQuantity bought.
+// Coupons without a SellerId are platform coupons.
+type Coupon struct {
+	ID           string     `json:"couponId"`
+	Code         string     `json:"code" validate:"required,min=3,max=32,alphanum"`
+	Type         string     `json:"type" validate:"required,oneof=percentage fixed free_quantity"`
+	Value        int64      `json:"value" validate:"required,min=1"`
+	Currency     *string    `json:"currency" validate:"required_if=Type fixed,omitempty,iso4217"`
+	MinQuantity  int64      `json:"minQuantity" validate:"omitempty,min=1"`
+	ProductIds   []string   `json:"productIds" validate:"max=100,dive,uuid"`
+	Tags         []string   `json:"tags" validate:"max=20,dive,min=1"`
+	StartsAt     *time.Time `json:"startsAt"`
+	EndsAt       *time.Time `json:"endsAt"`
+	UsageLimit   *int64     `json:"usageLimit" validate:"omitempty,min=1"`
+	PerUserLimit *int64     `json:"perUserLimit" validate:"omitempty,min=1"`
+	UsageCount   int64      `json:"usageCount"`
+	SellerId     *string    `json:"sellerId"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type CouponFilter struct {
+	Limit  *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
+}
+
+type PurchasePreview struct {
+	Quantity   int64   `json:"quantity" validate:"required,min=1"`
+	VariantId  *string `json:"variantId" validate:"omitempty,uuid"`
+	CouponCode *string `json:"couponCode" validate:"omitempty,max=32"`
+}
+
+type PurchasePricing struct {
+	UnitPrice  Money   `json:"unitPrice"`
+	Subtotal   Money   `json:"subtotal"`
+	Discount   Money   `json:"discount"`
+	Total      Money   `json:"total"`
+	CouponCode *string `json:"couponCode"`
+}
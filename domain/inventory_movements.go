@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+const (
+	MovementInitial    = "initial"
+	MovementRestock    = "restock"
+	MovementCorrection = "correction"
+	MovementDamage     = "damage"
+	MovementPurchase   = "purchase"
+)
+
+type InventoryMovement struct {
+	ID         string    `json:"movementId"`
+	ProductId  string    `json:"productId"`
+	VariantId  *string   `json:"variantId"`
+	Quantity   int64     `json:"quantity"`
+	Reason     string    `json:"reason"`
+	Note       string    `json:"note"`
+	StockAfter int64     `json:"stockAfter"`
+	PaymentId  *string   `json:"paymentId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// StockAdjustment is relative, a restock adds and a damage removes stock.
+type StockAdjustment struct {
+	VariantId *string `json:"variantId" validate:"omitempty,uuid"`
+	Quantity  *int64  `json:"quantity" validate:"required,ne=0"`
+	Reason    string  `json:"reason" validate:"required,oneof=restock correction damage"`
+	Note      string  `json:"note" validate:"max=255"`
+}
+
+type InventoryMovementFilter struct {
+	VariantId string `json:"variantId" validate:"omitempty,uuid" schema:"variantId"`
+	Limit     *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset    *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
+}
@@ -3,5 +3,35 @@ package domain
 type Meta struct {
 	Limit  int64 `json:"limit"`
 	Offset int64 `json:"offset"`
-	Total  int64 `json:"total"`
+	// Total is left out when the listing is asked to skip counting.
+	Total *int64 `json:"total,omitempty"`
+	// Next and Prev are keyset cursors to the neighbouring pages.
+	Next *string `json:"next,omitempty"`
+	Prev *string `json:"prev,omitempty"`
+	// Facets is only set when the listing is asked for facets.
+	Facets *Facets `json:"facets,omitempty"`
+}
+
+type Facets struct {
+	Condition []FacetCount  `json:"condition,omitempty"`
+	Tags      []FacetCount  `json:"tags,omitempty"`
+	Price     []PriceBucket `json:"price,omitempty"`
+	Stock     *StockFacet   `json:"stock,omitempty"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type PriceBucket struct {
+	Min      int64  `json:"min"`
+	Max      int64  `json:"max"`
+	Currency string `json:"currency"`
+	Count    int64  `json:"count"`
+}
+
+type StockFacet struct {
+	InStock    int64 `json:"inStock"`
+	OutOfStock int64 `json:"outOfStock"`
 }
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts sent without a currency, it is
+// overridden by DEFAULT_CURRENCY on startup.
+var DefaultCurrency = "IDR"
+
+var (
+	ErrCurrencyMismatch = errors.New("amounts have different currencies")
+	ErrAmountOverflow   = errors.New("amount overflows")
+)
+
+// Money is an amount in the minor unit of an ISO 4217 currency, e.g. cents
+// for USD. Amounts of different currencies are never added up.
+type Money struct {
+	Amount   int64  `json:"amount" validate:"min=0"`
+	Currency string `json:"currency" validate:"required,iso4217"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(m.Amount+o.Amount, m.Currency), nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	if (o.Amount < 0 && m.Amount > math.MaxInt64+o.Amount) || (o.Amount > 0 && m.Amount < math.MinInt64+o.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(m.Amount-o.Amount, m.Currency), nil
+}
+
+func (m Money) Multiply(quantity int64) (Money, error) {
+	if (quantity == -1 && m.Amount == math.MinInt64) || (quantity != 0 && (m.Amount*quantity)/quantity != m.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(m.Amount*quantity, m.Currency), nil
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+}
+
+// UnmarshalJSON also accepts a bare amount, as sent before prices had a
+// currency, and reads it in the default currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' {
+		var amount int64
+		if err := json.Unmarshal(data, &amount); err != nil {
+			return err
+		}
+		*m = NewMoney(amount, DefaultCurrency)
+		return nil
+	}
+
+	type money Money
+	var decoded money
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	decoded.Currency = strings.ToUpper(decoded.Currency)
+	if decoded.Currency == "" {
+		decoded.Currency = DefaultCurrency
+	}
+	*m = Money(decoded)
+	return nil
+}
+
+// Scan reads money selected as json_build_object('amount', ..., 'currency', ...).
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
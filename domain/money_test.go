@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		m, o    Money
+		want    Money
+		wantErr error
+	}{
+		{"same currency", NewMoney(150, "USD"), NewMoney(250, "USD"), NewMoney(400, "USD"), nil},
+		{"negative", NewMoney(150, "USD"), NewMoney(-250, "USD"), NewMoney(-100, "USD"), nil},
+		{"up to the max", NewMoney(math.MaxInt64-1, "IDR"), NewMoney(1, "IDR"), NewMoney(math.MaxInt64, "IDR"), nil},
+		{"currency mismatch", NewMoney(150, "USD"), NewMoney(150, "IDR"), Money{}, ErrCurrencyMismatch},
+		{"overflow", NewMoney(math.MaxInt64, "IDR"), NewMoney(1, "IDR"), Money{}, ErrAmountOverflow},
+		{"underflow", NewMoney(math.MinInt64, "IDR"), NewMoney(-1, "IDR"), Money{}, ErrAmountOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Add(tt.o)
+			if err != tt.wantErr {
+				t.Fatalf("Add() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Add() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name    string
+		m, o    Money
+		want    Money
+		wantErr error
+	}{
+		{"same currency", NewMoney(400, "USD"), NewMoney(150, "USD"), NewMoney(250, "USD"), nil},
+		{"below zero", NewMoney(150, "USD"), NewMoney(400, "USD"), NewMoney(-250, "USD"), nil},
+		{"down to the min", NewMoney(-1, "IDR"), NewMoney(math.MaxInt64, "IDR"), NewMoney(math.MinInt64, "IDR"), nil},
+		{"currency mismatch", NewMoney(400, "USD"), NewMoney(150, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"overflow", NewMoney(math.MaxInt64, "IDR"), NewMoney(-1, "IDR"), Money{}, ErrAmountOverflow},
+		{"overflow by the min", NewMoney(0, "IDR"), NewMoney(math.MinInt64, "IDR"), Money{}, ErrAmountOverflow},
+		{"underflow", NewMoney(math.MinInt64, "IDR"), NewMoney(1, "IDR"), Money{}, ErrAmountOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Sub(tt.o)
+			if err != tt.wantErr {
+				t.Fatalf("Sub() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Sub() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyMultiply(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		quantity int64
+		want     Money
+		wantErr  error
+	}{
+		{"quantity", NewMoney(1500, "USD"), 3, NewMoney(4500, "USD"), nil},
+		{"zero", NewMoney(1500, "USD"), 0, NewMoney(0, "USD"), nil},
+		{"negative", NewMoney(1500, "USD"), -2, NewMoney(-3000, "USD"), nil},
+		{"overflow", NewMoney(math.MaxInt64/2+1, "IDR"), 2, Money{}, ErrAmountOverflow},
+		{"overflow of the min", NewMoney(math.MinInt64, "IDR"), -1, Money{}, ErrAmountOverflow},
+		{"large quantity", NewMoney(-1, "IDR"), math.MinInt64, Money{}, ErrAmountOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Multiply(tt.quantity)
+			if err != tt.wantErr {
+				t.Fatalf("Multiply() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Multiply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{"object", `{"amount": 1999, "currency": "USD"}`, NewMoney(1999, "USD"), false},
+		{"lower case currency", `{"amount": 1999, "currency": "usd"}`, NewMoney(1999, "USD"), false},
+		{"missing currency", `{"amount": 1999}`, NewMoney(1999, DefaultCurrency), false},
+		{"bare amount", `1999`, NewMoney(1999, DefaultCurrency), false},
+		{"bare amount with spaces", ` 1999 `, NewMoney(1999, DefaultCurrency), false},
+		{"fractional amount", `19.99`, Money{}, true},
+		{"string amount", `"1999"`, Money{}, true},
+		{"invalid object", `{"amount": "a"}`, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
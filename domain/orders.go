@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+type Order struct {
+	ID                   string     `json:"orderId"`
+	SellerId             string     `json:"sellerId"`
+	BankAccountId        string     `json:"bankAccountId"`
+	PaymentProofImageUrl string     `json:"paymentProofImageUrl"`
+	Total                Money      `json:"total"`
+	Payments             []Payments `json:"payments"`
+	CreatedAt            time.Time  `json:"createdAt"`
+	ClosedAt             *time.Time `json:"closedAt"`
+}
@@ -1,10 +1,48 @@
 package domain
 
+import "time"
+
+const (
+	PaymentPaid     = "paid"
+	PaymentShipped  = "shipped"
+	PaymentReceived = "received"
+)
+
 type Payments struct {
-	ID                   string `json:"id"`
-	BankAccountId        string `json:"bankAccountId" validate:"required"`
-	PaymentProofImageUrl string `json:"paymentProofImageUrl" validate:"required,url"`
-	Quantity             int64  `json:"quantity" validate:"required,min=1"`
-	ProductId            string `json:"product_id"`
-	UserId               string `json:"user_id"`
+	ID                   string  `json:"id"`
+	BankAccountId        string  `json:"bankAccountId" validate:"required"`
+	PaymentProofImageUrl string  `json:"paymentProofImageUrl" validate:"required,url"`
+	Quantity             int64   `json:"quantity" validate:"required,min=1"`
+	VariantId            *string `json:"variantId" validate:"omitempty,uuid"`
+	ProductId            string  `json:"product_id"`
+	UserId               string  `json:"user_id"`
+	OrderId              *string `json:"orderId,omitempty" validate:"-"`
+	CouponCode           *string `json:"couponCode" validate:"omitempty,max=32"`
+	// AddressId defaults to the default address of the buyer, the address is
+	// copied to ShippingAddress at the time of the purchase.
+	AddressId       *string   `json:"addressId,omitempty" validate:"omitempty,uuid"`
+	ShippingAddress *Address  `json:"shippingAddress" validate:"-"`
+	Status          string    `json:"status" validate:"-"`
+	Shipment        *Shipment `json:"shipment,omitempty" validate:"-"`
+	CreatedAt       time.Time `json:"createdAt" validate:"-"`
+	// UnitPrice and Total are what the buyer paid at the time of the
+	// purchase, Total is after the Discount of the coupon.
+	UnitPrice Money `json:"unitPrice" validate:"-"`
+	Discount  Money `json:"discount" validate:"-"`
+	Total     Money `json:"total" validate:"-"`
+}
+
+// Shipment is set by the seller once the payment is shipped, ReceivedAt by
+// the buyer once it arrived.
+type Shipment struct {
+	Carrier        string     `json:"carrier" validate:"required,max=30"`
+	TrackingNumber string     `json:"trackingNumber" validate:"required,max=60"`
+	ShippedAt      *time.Time `json:"shippedAt"`
+	ReceivedAt     *time.Time `json:"receivedAt"`
+}
+
+type PaymentFilter struct {
+	Status string `json:"status" validate:"omitempty,oneof=paid shipped received" schema:"status"`
+	Limit  *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
 }
@@ -0,0 +1,12 @@
+package domain
+
+type ProductImage struct {
+	ID       string `json:"imageId"`
+	Url      string `json:"url" validate:"required,url"`
+	AltText  string `json:"altText" validate:"max=200"`
+	Position int    `json:"position"`
+}
+
+type ProductImageOrder struct {
+	ImageIds []string `json:"imageIds" validate:"required,min=1,dive,uuid"`
+}
@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+const (
+	ImportFormatCsv    = "csv"
+	ImportFormatNdjson = "ndjson"
+
+	// ImportModeCreate inserts every row, ImportModeUpsert updates the
+	// seller's product with the same sku when there is one.
+	ImportModeCreate = "create"
+	ImportModeUpsert = "upsert"
+
+	ImportStatusPending   = "pending"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+type ImportJob struct {
+	ID            string           `json:"jobId"`
+	Format        string           `json:"format"`
+	Mode          string           `json:"mode"`
+	Status        string           `json:"status"`
+	TotalRows     int64            `json:"totalRows"`
+	ProcessedRows int64            `json:"processedRows"`
+	SucceededRows int64            `json:"succeededRows"`
+	FailedRows    int64            `json:"failedRows"`
+	Errors        []ImportRowError `json:"errors"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	FinishedAt    *time.Time       `json:"finishedAt"`
+}
+
+// ImportRowError points at the line of the uploaded file that failed.
+type ImportRowError struct {
+	Row     int64  `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportFilter struct {
+	Format string `json:"format" validate:"omitempty,oneof=csv ndjson" schema:"format"`
+	Mode   string `json:"mode" validate:"omitempty,oneof=create upsert" schema:"mode"`
+}
+
+type ExportFilter struct {
+	Format string `json:"format" validate:"omitempty,oneof=csv ndjson" schema:"format"`
+}
@@ -0,0 +1,16 @@
+package domain
+
+type ProductVariant struct {
+	ID        string            `json:"variantId"`
+	ProductId string            `json:"productId"`
+	Sku       string            `json:"sku" validate:"required,min=1,max=64,noSpace"`
+	Options   map[string]string `json:"options" validate:"required,min=1,max=5,dive,keys,min=1,max=30,endkeys,required,max=30"`
+	Price     *Money            `json:"price" validate:"omitempty"`
+	Stock     *int64            `json:"stock" validate:"required,min=0"`
+	ImageUrl  *string           `json:"imageUrl" validate:"omitempty,url"`
+}
+
+type PriceRange struct {
+	Min Money `json:"min"`
+	Max Money `json:"max"`
+}
@@ -1,41 +1,112 @@
 package domain
 
+import "time"
+
+const (
+	ProductStatusDraft     = "draft"
+	ProductStatusPublished = "published"
+	ProductStatusScheduled = "scheduled"
+	ProductStatusUnlisted  = "unlisted"
+)
+
 type Product struct {
 	ID            string   `json:"id"`
+	Sku           *string  `json:"sku" validate:"omitempty,min=1,max=64,noSpace"`
 	Name          string   `json:"name" validate:"required,min=5,max=60"`
-	Price         *int64   `json:"price" validate:"required,min=0"`
+	Price         *Money   `json:"price" validate:"required"`
+	SalePrice     *Money   `json:"salePrice" validate:"omitempty"`
 	ImageUrl      string   `json:"imageUrl" validate:"required,url"`
 	Stock         *int64   `json:"stock" validate:"required,numeric,min=0"`
 	Condition     string   `json:"condition" validate:"required,eq=new|eq=second"`
 	Tags          []string `json:"tags" validate:"required,min=0,dive,min=0"`
 	IsPurchasable bool     `json:"isPurchasable" validate:"isBool"`
+	CategoryId    *string  `json:"categoryId" validate:"omitempty,uuid"`
+	// Status defaults to published, a scheduled product goes live at
+	// PublishAt and every product goes back to draft at UnpublishAt.
+	Status      string     `json:"status" validate:"omitempty,oneof=draft published scheduled unlisted"`
+	PublishAt   *time.Time `json:"publishAt" validate:"required_if=Status scheduled"`
+	UnpublishAt *time.Time `json:"unpublishAt"`
+	// the sale price applies between SaleStartsAt and SaleEndsAt, an open
+	// end means the sale has no limit on that side.
+	SaleStartsAt *time.Time `json:"saleStartsAt"`
+	SaleEndsAt   *time.Time `json:"saleEndsAt"`
 }
 type ProductData struct {
-	ID            string   `json:"productId"`
-	Name          string   `json:"name"`
-	Price         *int64   `json:"price"`
-	ImageUrl      string   `json:"imageUrl"`
-	Stock         *int64   `json:"stock"`
-	Condition     string   `json:"condition"`
-	Tags          []string `json:"tags"`
-	IsPurchasable bool     `json:"isPurchasable"`
-	PurchaseCount int64    `json:"purchaseCount"`
+	ID            string     `json:"productId"`
+	Sku           *string    `json:"sku,omitempty"`
+	Name          string     `json:"name"`
+	Price         Money      `json:"price"`
+	ImageUrl      string     `json:"imageUrl"`
+	Stock         *int64     `json:"stock"`
+	Condition     string     `json:"condition"`
+	Tags          []string   `json:"tags"`
+	IsPurchasable bool       `json:"isPurchasable"`
+	PurchaseCount int64      `json:"purchaseCount"`
+	PriceRange    PriceRange `json:"priceRange"`
+	CategoryId    *string    `json:"categoryId"`
+	Status        string     `json:"status,omitempty"`
+	PublishAt     *time.Time `json:"publishAt,omitempty"`
+	UnpublishAt   *time.Time `json:"unpublishAt,omitempty"`
+	Version       int64      `json:"version,omitempty"`
+	ArchivedAt    *time.Time `json:"archivedAt,omitempty"`
+	Highlight     *string    `json:"highlight,omitempty"`
+	// OriginalPrice and SaleEndsAt are only set while the product is on sale.
+	OriginalPrice *Money     `json:"originalPrice,omitempty"`
+	SaleEndsAt    *time.Time `json:"saleEndsAt,omitempty"`
+	// Rating is the average and count of the visible reviews.
+	Rating RatingSummary `json:"rating"`
+	// Live is whether the product is reachable by the public right now.
+	Live bool `json:"-"`
 }
 
 type ProductFilter struct {
 	UserOnly       bool     `json:"userOnly" schema:"userOnly"`
-	Limit          *int64   `json:"limit" validate:"required,numeric" schema:"limit"`
-	Offset         *int64   `json:"offset" validate:"required,numeric" schema:"offset"`
+	Limit          *int64   `json:"limit" validate:"required,min=1,max=100" schema:"limit"`
+	Offset         *int64   `json:"offset" validate:"required_without=Cursor,omitempty,min=0" schema:"offset"`
+	Cursor         string   `json:"cursor" schema:"cursor"`
+	SkipTotal      bool     `json:"skipTotal" schema:"skipTotal"`
 	Tags           []string `json:"tags" validate:"min=0,dive,min=0" schema:"tags"`
 	Condition      string   `json:"condition" validate:"omitempty,eq=new|eq=second" schema:"condition"`
+	Category       string   `json:"category" validate:"omitempty,slug" schema:"category"`
+	Status         string   `json:"status" validate:"omitempty,oneof=draft published scheduled unlisted" schema:"status"`
 	ShowEmptyStock bool     `json:"showEmptyStock" schema:"showEmptyStock"`
 	MaxPrice       *int64   `json:"maxPrice" validate:"required_with=MinPrice,omitempty,numeric,min=0" schema:"maxPrice"`
 	MinPrice       *int64   `json:"minPrice" validate:"required_with=MaxPrice,omitempty,numeric,min=0" schema:"minPrice"`
-	SortBy         string   `json:"sortBy" validate:"omitempty,eq=new|eq=second" schema:"sortBy"`
+	Currency       string   `json:"currency" validate:"omitempty,iso4217" schema:"currency"`
+	MinRating      *float64 `json:"minRating" validate:"omitempty,min=1,max=5" schema:"minRating"`
+	SortBy         string   `json:"sortBy" validate:"omitempty,max=100" schema:"sortBy"`
 	OrderBy        string   `json:"orderBy" validate:"omitempty,eq=asc|eq=desc" schema:"orderBy"`
 	Search         string   `json:"search" validate:"omitempty,min=3" schema:"search"`
+	Facets         []string `json:"facets" validate:"omitempty,dive,oneof=condition tags price stock" schema:"facets"`
+}
+type ArchivedProductFilter struct {
+	Limit  *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
+}
+
+type PriceHistory struct {
+	ID           string     `json:"priceHistoryId"`
+	Price        Money      `json:"price"`
+	SalePrice    *Money     `json:"salePrice"`
+	SaleStartsAt *time.Time `json:"saleStartsAt"`
+	SaleEndsAt   *time.Time `json:"saleEndsAt"`
+	ChangedAt    time.Time  `json:"changedAt"`
 }
+
+type PriceHistoryFilter struct {
+	Limit  *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
+}
+
+type SuggestFilter struct {
+	Q     string `json:"q" validate:"required,min=1,max=50" schema:"q"`
+	Limit *int   `json:"limit" validate:"omitempty,min=1,max=20" schema:"limit"`
+}
+
 type ProductDetail struct {
-	Product ProductData    `json:"product"`
-	Seller  UserSellerData `json:"seller"`
+	Product     ProductData      `json:"product"`
+	Seller      UserSellerData   `json:"seller"`
+	Breadcrumbs []Breadcrumb     `json:"breadcrumbs"`
+	Variants    []ProductVariant `json:"variants"`
+	Images      []ProductImage   `json:"images"`
 }
@@ -0,0 +1,60 @@
+package domain
+
+import "time"
+
+const (
+	ReviewVisible = "visible"
+	ReviewHidden  = "hidden"
+)
+
+const (
+	ModerationHide    = "hide"
+	ModerationRestore = "restore"
+	ModerationDismiss = "dismiss"
+)
+
+type Review struct {
+	ID          string     `json:"reviewId"`
+	ProductId   string     `json:"productId"`
+	PaymentId   string     `json:"paymentId"`
+	Reviewer    string     `json:"reviewer"`
+	Rating      int64      `json:"rating"`
+	Body        string     `json:"body"`
+	Reply       *string    `json:"reply"`
+	RepliedAt   *time.Time `json:"repliedAt"`
+	Status      string     `json:"status"`
+	ReportCount int64      `json:"reportCount"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	ModeratedAt *time.Time `json:"moderatedAt,omitempty"`
+	SellerId    string     `json:"-"`
+	UserId      string     `json:"-"`
+}
+
+type ReviewCreate struct {
+	Rating int64  `json:"rating" validate:"required,min=1,max=5"`
+	Body   string `json:"body" validate:"max=2000"`
+}
+
+type ReviewUpdate struct {
+	Rating *int64  `json:"rating" validate:"omitempty,min=1,max=5"`
+	Body   *string `json:"body" validate:"omitempty,max=2000"`
+}
+
+type ReviewReply struct {
+	Reply string `json:"reply" validate:"required,min=1,max=2000"`
+}
+
+type ReviewReport struct {
+	Reason string `json:"reason" validate:"required,min=3,max=255"`
+}
+
+type ReviewModeration struct {
+	Action string `json:"action" validate:"required,oneof=hide restore dismiss"`
+}
+
+type ReviewFilter struct {
+	Limit  *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
+	Rating *int64 `json:"rating" validate:"omitempty,min=1,max=5" schema:"rating"`
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+type Session struct {
+	ID         string    `json:"sessionId"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+type SessionRefresh struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type SessionTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
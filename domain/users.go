@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
@@ -19,13 +21,51 @@ type UserLogin struct {
 }
 
 type UserAuthResponse struct {
-	Name        string `json:"name"`
-	Username    string `json:"username"`
-	AccessToken string `json:"accessToken"`
+	Name         string `json:"name"`
+	Username     string `json:"username"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 type UserSellerData struct {
 	Name             string        `json:"name"`
 	ProductSoldTotal string        `json:"productSoldTotal"`
+	Rating           RatingSummary `json:"rating"`
 	BankAccounts     []BankAccount `json:"bankAccounts"`
 }
+
+type UserProfile struct {
+	ID               string    `json:"id"`
+	Username         string    `json:"username"`
+	Name             string    `json:"name"`
+	ProductSoldTotal int64     `json:"productSoldTotal"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+type UserProfileUpdate struct {
+	Name     *string `json:"name" validate:"omitempty,min=5,max=50"`
+	Username *string `json:"username" validate:"omitempty,min=5,max=15,noSpace"`
+}
+
+type UserDelete struct {
+	Password string `json:"password" validate:"required,min=5,max=15"`
+}
+
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int64   `json:"count"`
+}
+
+type SellerProfile struct {
+	Username         string        `json:"username"`
+	Name             string        `json:"name"`
+	JoinedAt         time.Time     `json:"joinedAt"`
+	ProductSoldTotal int64         `json:"productSoldTotal"`
+	Rating           RatingSummary `json:"rating"`
+	Products         []ProductData `json:"products"`
+}
+
+type SellerFilter struct {
+	Limit  *int64 `json:"limit" validate:"omitempty,min=1,max=100" schema:"limit"`
+	Offset *int64 `json:"offset" validate:"omitempty,min=0" schema:"offset"`
+}
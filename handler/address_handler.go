@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const maxAddresses = 20
+
+type AddressHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+}
+
+func NewAddressHandler(db *sql.DB, validate *validator.Validate) *AddressHandler {
+	return &AddressHandler{
+		db:       db,
+		validate: validate,
+	}
+}
+
+const addressColumnsSql = `id, label, recipient_name, phone, street, city, region, postal_code, country, is_default`
+
+func (ah *AddressHandler) Index(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+
+	rows, err := ah.db.Query(`SELECT `+addressColumnsSql+` FROM addresses WHERE user_id = $1 ORDER BY is_default DESC, created_at, id`, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	addresses := make([]domain.Address, 0)
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		addresses = append(addresses, address)
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"success",
+		addresses,
+	))
+}
+
+func (ah *AddressHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var (
+		data  domain.Address
+		count int
+	)
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ah.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ah.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// the user row serializes concurrent changes to the address book
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := tx.QueryRow(`SELECT count(id) FROM addresses WHERE user_id = $1`, userId).Scan(&count); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if count >= maxAddresses {
+		fmt.Println("address limit reached")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("a user can have at most %d addresses", maxAddresses)))
+		return
+	}
+
+	// the first address is the default one
+	data.IsDefault = data.IsDefault || count == 0
+	if data.IsDefault {
+		if _, err := tx.Exec(`UPDATE addresses SET is_default = false WHERE user_id = $1 AND is_default`, userId); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	data.ID = uuid.New().String()
+	if _, err := tx.Exec(
+		`INSERT INTO addresses (id,user_id,label,recipient_name,phone,street,city,region,postal_code,country,is_default) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
+		data.ID, userId, data.Label, data.RecipientName, data.Phone, data.Street, data.City, data.Region, data.PostalCode, data.Country, data.IsDefault,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"address added successfully",
+		data,
+	))
+}
+
+func (ah *AddressHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var data domain.AddressUpdate
+
+	addressId := chi.URLParam(r, "addressId")
+	if err := validation.UuidValidation(addressId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ah.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ah.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	// there is always a default address, it only moves to another address
+	if data.IsDefault != nil && *data.IsDefault {
+		if _, err := tx.Exec(`UPDATE addresses SET is_default = false WHERE user_id = $1 AND is_default AND id <> $2`, userId, addressId); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	address, err := scanAddress(tx.QueryRow(
+		`UPDATE addresses SET label = COALESCE($1, label), recipient_name = COALESCE($2, recipient_name), phone = COALESCE($3, phone), street = COALESCE($4, street),
+		city = COALESCE($5, city), region = COALESCE($6, region), postal_code = COALESCE($7, postal_code), country = COALESCE($8, country), is_default = is_default OR COALESCE($9, false)
+		WHERE id = $10 AND user_id = $11 RETURNING `+addressColumnsSql,
+		data.Label, data.RecipientName, data.Phone, data.Street, data.City, data.Region, data.PostalCode, data.Country, data.IsDefault, addressId, userId,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println("address not found")
+			response.Error(w, apierror.ClientNotFound("address"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update address"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"address updated successfully",
+		address,
+	))
+}
+
+func (ah *AddressHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	addressId := chi.URLParam(r, "addressId")
+	if err := validation.UuidValidation(addressId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ah.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	var wasDefault bool
+	if err := tx.QueryRow(`DELETE FROM addresses WHERE id = $1 AND user_id = $2 RETURNING is_default`, addressId, userId).Scan(&wasDefault); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println("address not found")
+			response.Error(w, apierror.ClientNotFound("address"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete address"))
+		return
+	}
+
+	// the newest remaining address takes over as the default one
+	if wasDefault {
+		if _, err := tx.Exec(
+			`UPDATE addresses SET is_default = true WHERE id = (SELECT id FROM addresses WHERE user_id = $1 ORDER BY created_at DESC, id LIMIT 1)`,
+			userId,
+		); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"address deleted successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: addressId,
+		},
+	))
+}
+
+func scanAddress(row interface{ Scan(...interface{}) error }) (domain.Address, error) {
+	var address domain.Address
+	err := row.Scan(&address.ID, &address.Label, &address.RecipientName, &address.Phone, &address.Street, &address.City, &address.Region, &address.PostalCode, &address.Country, &address.IsDefault)
+	return address, err
+}
+
+// shippingAddress reads the address a purchase is shipped to, the default
+// address of the buyer when addressId is not given.
+func shippingAddress(tx *sql.Tx, userId string, addressId *string) (*domain.Address, *apierror.Error) {
+	var row *sql.Row
+	if addressId != nil {
+		row = tx.QueryRow(`SELECT `+addressColumnsSql+` FROM addresses WHERE id = $1 AND user_id = $2`, *addressId, userId)
+	} else {
+		row = tx.QueryRow(`SELECT `+addressColumnsSql+` FROM addresses WHERE user_id = $1 AND is_default`, userId)
+	}
+
+	address, err := scanAddress(row)
+	if err != nil {
+		if err == sql.ErrNoRows && addressId != nil {
+			apiErr := apierror.ClientNotFound("address")
+			return nil, &apiErr
+		}
+		if err == sql.ErrNoRows {
+			apiErr := apierror.CustomError(http.StatusBadRequest, "addressId is required, add an address to /v1/user/addresses first")
+			return nil, &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return nil, &apiErr
+	}
+	return &address, nil
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/apikey"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const maxActiveApiKeys = 10
+
+type ApiKeyHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+}
+
+func NewApiKeyHandler(db *sql.DB, validate *validator.Validate) *ApiKeyHandler {
+	return &ApiKeyHandler{
+		db:       db,
+		validate: validate,
+	}
+}
+
+func (akh *ApiKeyHandler) Index(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+	if userId == "" {
+		fmt.Println("userId not found in context")
+		response.Error(w, apierror.CustomError(http.StatusForbidden, "userId not found in context"))
+		return
+	}
+
+	rows, err := akh.db.Query(`SELECT id, name, prefix, scopes, created_at, last_used_at, revoked_at FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	data := make([]domain.ApiKey, 0)
+	for rows.Next() {
+		var apiKey domain.ApiKey
+		err := rows.Scan(&apiKey.ID, &apiKey.Name, &apiKey.Prefix, pq.Array(&apiKey.Scopes), &apiKey.CreatedAt, &apiKey.LastUsedAt, &apiKey.RevokedAt)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		data = append(data, apiKey)
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"success",
+		data,
+	))
+}
+
+func (akh *ApiKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var data domain.ApiKeyCreate
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := akh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if userId == "" {
+		fmt.Println("userId not found in context")
+		response.Error(w, apierror.CustomError(http.StatusForbidden, "userId not found in context"))
+		return
+	}
+
+	var count int
+	if err := akh.db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`, userId).Scan(&count); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if count >= maxActiveApiKeys {
+		fmt.Println("api key limit reached")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("you can have at most %d active api keys", maxActiveApiKeys)))
+		return
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to generate api key"))
+		return
+	}
+
+	uuid := uuid.New()
+	date := time.Now()
+	if _, err := akh.db.Exec(
+		`INSERT INTO api_keys (id,name,prefix,key_hash,scopes,user_id,created_at) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		uuid, data.Name, prefix, hash, pq.Array(data.Scopes), userId, date,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"api key created successfully, store it now as it will not be shown again",
+		domain.ApiKeyCreated{
+			ApiKey: domain.ApiKey{
+				ID:        uuid.String(),
+				Name:      data.Name,
+				Prefix:    prefix,
+				Scopes:    data.Scopes,
+				CreatedAt: date,
+			},
+			Key: key,
+		},
+	))
+}
+
+func (akh *ApiKeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var id string
+	userId := r.Context().Value("user_id").(string)
+
+	apiKeyId := chi.URLParam(r, "apiKeyId")
+	if err := validation.UuidValidation(apiKeyId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	err := akh.db.QueryRow("SELECT user_id FROM api_keys WHERE id = $1", apiKeyId).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("api key"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if id != userId {
+		// do not reveal keys of other users
+		fmt.Println("api key belongs to another user")
+		response.Error(w, apierror.ClientNotFound("api key"))
+		return
+	}
+
+	_, err = akh.db.Exec(`UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, time.Now(), apiKeyId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to revoke api key"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"api key revoked successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: apiKeyId,
+		},
+	))
+}
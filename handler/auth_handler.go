@@ -5,13 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/clientip"
 	"github.com/Croazt/shopifyx/utils/jwt"
+	"github.com/Croazt/shopifyx/utils/loginguard"
 	"github.com/Croazt/shopifyx/utils/response"
 	apierror "github.com/Croazt/shopifyx/utils/response/error"
 	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/session"
 	"github.com/Croazt/shopifyx/utils/validation"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
@@ -19,15 +23,26 @@ import (
 )
 
 type AuthHandler struct {
-	db        *sql.DB
-	validator *validator.Validate
+	db         *sql.DB
+	validator  *validator.Validate
+	loginGuard *loginguard.Guard
+	dummyHash  []byte
+	sessions   *session.Store
 }
 
+// dummyHash is compared against the passwords of unknown usernames so they
+// take as long as wrong passwords. It is the hash of a random password at
+// bcrypt.DefaultCost, the cost passwords are hashed with on register.
+const dummyHash = "$2a$10$p1i./GolSqnvwF0TTCSudODT9MZd0FXNjvbW8YtQcBFqKBEX2uV2e"
+
 // NewUserHandler creates a new instance of UserHandler
-func NewAuthHandler(db *sql.DB, validator *validator.Validate) *AuthHandler {
+func NewAuthHandler(db *sql.DB, validator *validator.Validate, sessions *session.Store) *AuthHandler {
 	return &AuthHandler{
-		db:        db,
-		validator: validator,
+		db:         db,
+		validator:  validator,
+		loginGuard: loginguard.New(loginguard.DefaultConfig()),
+		dummyHash:  []byte(dummyHash),
+		sessions:   sessions,
 	}
 }
 
@@ -89,9 +104,7 @@ func (uh *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := jwt.SignedToken(jwt.Claim{
-		UserId: id,
-	})
+	tokenString, refreshToken, err := uh.startSession(r, id)
 	if err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError("Failed to generate access token"))
@@ -99,9 +112,10 @@ func (uh *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := &domain.UserAuthResponse{
-		Name:        registerData.Name,
-		Username:    registerData.Username,
-		AccessToken: tokenString,
+		Name:         registerData.Name,
+		Username:     registerData.Username,
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
 	}
 
 	response.Success(w, apisuccess.RegisterResponse(res))
@@ -127,24 +141,49 @@ func (uh *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// loginData.Username = strings.ToLower(loginData.Username)
 
+	keys := []loginguard.Key{
+		loginguard.Username(loginData.Username),
+		loginguard.IP(clientip.FromRequest(r)),
+	}
+	attempt, wait := uh.loginGuard.Begin(keys...)
+	if wait > 0 {
+		fmt.Printf("login for %s is locked for %s\n", loginData.Username, wait)
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+1)))
+		response.Error(w, apierror.ClientTooManyRequests())
+		return
+	}
+	defer attempt.Done()
+
 	var user domain.User
-	err := uh.db.QueryRow("SELECT id,username,name,password FROM users WHERE username = $1 LIMIT 1;", loginData.Username).Scan(&user.ID, &user.Username, &user.Name, &user.Password)
+	err := uh.db.QueryRow("SELECT id,username,name,password FROM users WHERE username = $1 AND deleted_at IS NULL LIMIT 1;", loginData.Username).Scan(&user.ID, &user.Username, &user.Name, &user.Password)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
 
-	if err != nil {
+	if err == sql.ErrNoRows {
+		// compare against a dummy hash so unknown usernames take as long as
+		// wrong passwords
+		bcrypt.CompareHashAndPassword(uh.dummyHash, []byte(loginData.Password))
 		fmt.Println(err.Error())
-		response.Error(w, apierror.ClientNotFound("Username"))
+		attempt.Fail()
+		response.Error(w, apierror.ClientInvalidCredential())
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginData.Password)); err != nil {
 		fmt.Println(err.Error())
-		response.Error(w, apierror.CustomError(400, "Password missmatched"))
+		attempt.Fail()
+		response.Error(w, apierror.ClientInvalidCredential())
 		return
 	}
 
-	tokenString, err := jwt.SignedToken(jwt.Claim{
-		UserId: user.ID,
-	})
+	// only the username is reset, otherwise a client could clear its ip
+	// counter by logging into an account it owns
+	uh.loginGuard.Reset(loginguard.Username(loginData.Username))
+
+	tokenString, refreshToken, err := uh.startSession(r, user.ID)
 	if err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError("Failed to generate access token"))
@@ -152,10 +191,81 @@ func (uh *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := &domain.UserAuthResponse{
-		Name:        user.Name,
-		Username:    user.Username,
-		AccessToken: tokenString,
+		Name:         user.Name,
+		Username:     user.Username,
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
 	}
 
 	response.Success(w, apisuccess.LoginResponse(res))
 }
+
+// Refresh trades the refresh token of a session for a new access token and
+// refresh token, extending the session.
+func (uh *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var data domain.SessionRefresh
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := uh.validator.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	sessionId, userId, refreshToken, err := uh.sessions.Refresh(data.RefreshToken)
+	if err != nil {
+		fmt.Println(err.Error())
+		if err == sql.ErrNoRows {
+			response.Error(w, apierror.ClientAccessExpired())
+			return
+		}
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	tokenString, err := signToken(sessionId, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("Failed to generate access token"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"session refreshed successfully",
+		domain.SessionTokens{
+			AccessToken:  tokenString,
+			RefreshToken: refreshToken,
+		},
+	))
+}
+
+// startSession starts a new session for the user and returns an access token
+// bound to it and its refresh token.
+func (uh *AuthHandler) startSession(r *http.Request, userId string) (string, string, error) {
+	sessionId, refreshToken, err := uh.sessions.Create(userId, r.UserAgent(), clientip.FromRequest(r))
+	if err != nil {
+		return "", "", err
+	}
+
+	tokenString, err := signToken(sessionId, userId)
+	if err != nil {
+		return "", "", err
+	}
+	return tokenString, refreshToken, nil
+}
+
+func signToken(sessionId string, userId string) (string, error) {
+	claim := jwt.Claim{
+		UserId: userId,
+	}
+	claim.Id = sessionId
+	return jwt.SignedToken(claim)
+}
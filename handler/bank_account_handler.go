@@ -36,7 +36,7 @@ func (bah *BankAccountHandler) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := bah.db.Query(`SELECT id,bank_name,bank_account_name, bank_account_number FROM bank_accounts WHERE user_id = $1`, userId)
+	rows, err := bah.db.Query(`SELECT id,bank_name,bank_account_name, bank_account_number FROM bank_accounts WHERE user_id = $1 AND deleted_at IS NULL`, userId)
 	if err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
@@ -141,7 +141,7 @@ func (bah *BankAccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err := bah.db.QueryRow("SELECT user_id FROM bank_accounts WHERE id = $1", bankAccountId).Scan(&id)
+	err := bah.db.QueryRow("SELECT user_id FROM bank_accounts WHERE id = $1 AND deleted_at IS NULL", bankAccountId).Scan(&id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println(err.Error())
@@ -197,7 +197,7 @@ func (bah *BankAccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := bah.db.QueryRow("SELECT user_id FROM bank_accounts WHERE id = $1", bankAccountId).Scan(&id)
+	err := bah.db.QueryRow("SELECT user_id FROM bank_accounts WHERE id = $1 AND deleted_at IS NULL", bankAccountId).Scan(&id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println(err.Error())
@@ -0,0 +1,569 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/suggest"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type CartHandler struct {
+	db          *sql.DB
+	validate    *validator.Validate
+	suggestions *suggest.Index
+}
+
+func NewCartHandler(db *sql.DB, validate *validator.Validate, suggestions *suggest.Index) *CartHandler {
+	return &CartHandler{
+		db:          db,
+		validate:    validate,
+		suggestions: suggestions,
+	}
+}
+
+// cartItemKeySql is the conflict target of cart_items_user_id_product_idx.
+const cartItemKeySql = `(user_id, product_id, COALESCE(variant_id, '00000000-0000-0000-0000-000000000000'))`
+
+// cartPurchasableSql matches products that can be bought right now.
+const cartPurchasableSql = `(products.is_purchasable AND products.deleted_at IS NULL AND ` + productLiveSql + `)`
+
+func (ch *CartHandler) Index(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+
+	cart, err := getCart(ch.db, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		cart,
+	))
+}
+
+func (ch *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	var data domain.CartItem
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ch.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// adding an item that is already in the cart adds to its quantity
+	var quantity int64
+	if err := tx.QueryRow(
+		`INSERT INTO cart_items (id,user_id,product_id,variant_id,quantity) VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT `+cartItemKeySql+` DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity, updated_at = now()
+		RETURNING quantity`,
+		uuid.New(), userId, data.ProductId, data.VariantId, *data.Quantity,
+	).Scan(&quantity); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			fmt.Println(err.Error())
+			if pqErr.Constraint == "cart_items_variant_id_fkey" {
+				response.Error(w, apierror.ClientNotFound("variant"))
+				return
+			}
+			response.Error(w, apierror.ClientNotFound("product"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to add item to cart"))
+		return
+	}
+
+	if apiErr := validateCartItem(tx, data.ProductId, data.VariantId, quantity); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	cart, err := getCart(ch.db, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"item added to cart",
+		cart,
+	))
+}
+
+func (ch *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	var (
+		data      domain.CartItemUpdate
+		productId string
+		variantId *string
+	)
+
+	itemId := chi.URLParam(r, "itemId")
+	if err := validation.UuidValidation(itemId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ch.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(
+		`UPDATE cart_items SET quantity = $1, updated_at = now() WHERE id = $2 AND user_id = $3 RETURNING product_id, variant_id`,
+		*data.Quantity, itemId, userId,
+	).Scan(&productId, &variantId); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println("cart item not found")
+			response.Error(w, apierror.ClientNotFound("cart item"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update cart item"))
+		return
+	}
+
+	if apiErr := validateCartItem(tx, productId, variantId, *data.Quantity); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	cart, err := getCart(ch.db, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"cart item updated",
+		cart,
+	))
+}
+
+func (ch *CartHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	itemId := chi.URLParam(r, "itemId")
+	if err := validation.UuidValidation(itemId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	res, err := ch.db.Exec(`DELETE FROM cart_items WHERE id = $1 AND user_id = $2`, itemId, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to remove cart item"))
+		return
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		fmt.Println("cart item not found")
+		response.Error(w, apierror.ClientNotFound("cart item"))
+		return
+	}
+
+	cart, err := getCart(ch.db, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"cart item removed",
+		cart,
+	))
+}
+
+// Checkout buys everything in the cart at once. The cart is split into one
+// order per seller, either every order is paid or none is.
+func (ch *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	var data domain.Checkout
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ch.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	for _, order := range data.Orders {
+		if err := validation.UrlValidation(order.PaymentProofImageUrl); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	items, err := lockCartItems(tx, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if len(items) == 0 {
+		fmt.Println("cart is empty")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "cart is empty"))
+		return
+	}
+
+	itemsBySeller := make(map[string][]domain.CartItemData)
+	for _, item := range items {
+		itemsBySeller[item.SellerId] = append(itemsBySeller[item.SellerId], item)
+	}
+
+	// every seller in the cart is paid to exactly one of their bank accounts
+	orders := make([]domain.Order, 0, len(data.Orders))
+	paid := make(map[string]bool)
+	for _, checkoutOrder := range data.Orders {
+		var sellerId string
+		if err := tx.QueryRow(`SELECT user_id FROM bank_accounts WHERE id = $1 AND deleted_at IS NULL`, checkoutOrder.BankAccountId).Scan(&sellerId); err != nil {
+			if err == sql.ErrNoRows {
+				fmt.Println("bank account not found")
+				response.Error(w, apierror.ClientNotFound("bank account"))
+				return
+			}
+
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+
+		if _, ok := itemsBySeller[sellerId]; !ok {
+			fmt.Println("bank account does not belong to a seller in the cart")
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, "bank account "+checkoutOrder.BankAccountId+" does not belong to a seller in the cart"))
+			return
+		}
+		if paid[sellerId] {
+			fmt.Println("seller is paid more than once")
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, "every seller is paid to a single bank account"))
+			return
+		}
+		paid[sellerId] = true
+
+		orders = append(orders, domain.Order{
+			ID:                   uuid.New().String(),
+			SellerId:             sellerId,
+			BankAccountId:        checkoutOrder.BankAccountId,
+			PaymentProofImageUrl: checkoutOrder.PaymentProofImageUrl,
+		})
+	}
+
+	for _, item := range items {
+		if !paid[item.SellerId] {
+			fmt.Println("seller is not paid")
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, "bankAccountId is required for seller "+item.SellerId))
+			return
+		}
+	}
+
+	address, apiErr := shippingAddress(tx, userId, data.AddressId)
+	if apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	for i := range orders {
+		if apiErr := checkoutOrder(tx, &orders[i], itemsBySeller[orders[i].SellerId], address, userId); apiErr != nil {
+			fmt.Println(apiErr.Message)
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cart_items WHERE user_id = $1`, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	for _, item := range items {
+		refreshSuggestion(ch.db, ch.suggestions, item.ProductId)
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"Checkout processed successfully",
+		orders,
+	))
+}
+
+// checkoutOrder inserts the order and one payment per item, all items of an
+// order have to be priced in the same currency.
+func checkoutOrder(tx *sql.Tx, order *domain.Order, items []domain.CartItemData, address *domain.Address, userId string) *apierror.Error {
+	payments := make([]domain.Payments, 0, len(items))
+	for _, item := range items {
+		if apiErr := validateCartItem(tx, item.ProductId, item.VariantId, item.Quantity); apiErr != nil {
+			return apiErr
+		}
+
+		price, err := purchasePrice(tx, item.ProductId, item.VariantId)
+		if err != nil {
+			apiErr := apierror.CustomServerError(err.Error())
+			return &apiErr
+		}
+
+		subtotal, err := price.Multiply(item.Quantity)
+		if err == nil {
+			if len(payments) == 0 {
+				order.Total = subtotal
+			} else {
+				order.Total, err = order.Total.Add(subtotal)
+			}
+		}
+		if err != nil {
+			apiErr := apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("items of seller %s can not be paid together: %s", order.SellerId, err.Error()))
+			return &apiErr
+		}
+
+		payments = append(payments, domain.Payments{
+			BankAccountId:        order.BankAccountId,
+			PaymentProofImageUrl: order.PaymentProofImageUrl,
+			Quantity:             item.Quantity,
+			VariantId:            item.VariantId,
+			ProductId:            item.ProductId,
+			UserId:               userId,
+			ShippingAddress:      address,
+			UnitPrice:            price,
+		})
+	}
+
+	if err := tx.QueryRow(
+		`INSERT INTO orders (id,user_id,seller_id,bank_account_id,payment_proof_image_url,total,currency) VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING created_at`,
+		order.ID, userId, order.SellerId, order.BankAccountId, order.PaymentProofImageUrl, order.Total.Amount, order.Total.Currency,
+	).Scan(&order.CreatedAt); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	for i := range payments {
+		if apiErr := recordPurchase(tx, &payments[i], order.SellerId, &order.ID); apiErr != nil {
+			return apiErr
+		}
+	}
+	order.Payments = payments
+	return nil
+}
+
+// validateCartItem checks that quantity of the product, or its variant, can
+// be bought right now.
+func validateCartItem(tx *sql.Tx, productId string, variantId *string, quantity int64) *apierror.Error {
+	var (
+		variants      int
+		variantFound  bool
+		isPurchasable bool
+		stock         int64
+	)
+	err := tx.QueryRow(
+		`SELECT (SELECT count(id) FROM product_variants WHERE product_id = products.id), v.id IS NOT NULL, `+cartPurchasableSql+`, COALESCE(v.stock, products.stock)
+		FROM products LEFT JOIN product_variants v ON v.product_id = products.id AND v.id = $2 WHERE products.id = $1`,
+		productId, variantId,
+	).Scan(&variants, &variantFound, &isPurchasable, &stock)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			apiErr := apierror.ClientNotFound("product")
+			return &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	// products with variants have to be bought as one of their variants
+	if variants > 0 && variantId == nil {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "variantId is required")
+		return &apiErr
+	}
+	if variantId != nil && !variantFound {
+		apiErr := apierror.ClientNotFound("variant")
+		return &apiErr
+	}
+
+	if !isPurchasable {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "product is not purchasable")
+		return &apiErr
+	}
+	if quantity > stock {
+		apiErr := apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("quantity exceeds the stock of %d", stock))
+		return &apiErr
+	}
+	return nil
+}
+
+// cartItemsSql selects the items of a cart with the product as it can be
+// bought right now.
+var cartItemsSql = `SELECT c.id, c.product_id, c.variant_id, v.options, products.user_id, products.name, COALESCE(v.image_url, products.image_url), c.quantity,
+	COALESCE(v.stock, products.stock), ` + cartPurchasableSql + `, ` + moneySql(`COALESCE(v.price, `+productPriceSql+`)`) + `
+	FROM cart_items c JOIN products ON products.id = c.product_id LEFT JOIN product_variants v ON v.id = c.variant_id
+	WHERE c.user_id = $1`
+
+func getCart(db *sql.DB, userId string) (domain.Cart, error) {
+	cart := domain.Cart{
+		Items:  make([]domain.CartItemData, 0),
+		Totals: make([]domain.Money, 0),
+	}
+
+	rows, err := db.Query(cartItemsSql+` ORDER BY c.created_at, c.id`, userId)
+	if err != nil {
+		return cart, err
+	}
+	if cart.Items, err = scanCartItems(rows); err != nil {
+		return cart, err
+	}
+
+	// items that can not be bought right now are left out of the totals
+	totals := make(map[string]int)
+	for _, item := range cart.Items {
+		if !item.IsPurchasable {
+			continue
+		}
+
+		i, ok := totals[item.Subtotal.Currency]
+		if !ok {
+			totals[item.Subtotal.Currency] = len(cart.Totals)
+			cart.Totals = append(cart.Totals, item.Subtotal)
+			continue
+		}
+		if cart.Totals[i], err = cart.Totals[i].Add(item.Subtotal); err != nil {
+			return cart, err
+		}
+	}
+	return cart, nil
+}
+
+// lockCartItems reads the cart for checkout, locking it against concurrent
+// changes until the checkout is done.
+func lockCartItems(tx *sql.Tx, userId string) ([]domain.CartItemData, error) {
+	rows, err := tx.Query(cartItemsSql+` ORDER BY c.created_at, c.id FOR UPDATE OF c`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanCartItems(rows)
+}
+
+func scanCartItems(rows *sql.Rows) ([]domain.CartItemData, error) {
+	defer rows.Close()
+
+	items := make([]domain.CartItemData, 0)
+	for rows.Next() {
+		var (
+			item    domain.CartItemData
+			options []byte
+		)
+		if err := rows.Scan(&item.ID, &item.ProductId, &item.VariantId, &options, &item.SellerId, &item.Name, &item.ImageUrl, &item.Quantity, &item.Stock, &item.IsPurchasable, &item.UnitPrice); err != nil {
+			return nil, err
+		}
+		if options != nil {
+			if err := json.Unmarshal(options, &item.Options); err != nil {
+				return nil, err
+			}
+		}
+
+		subtotal, err := item.UnitPrice.Multiply(item.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		item.Subtotal = subtotal
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type CategoryHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+}
+
+func NewCategoryHandler(db *sql.DB, validate *validator.Validate) *CategoryHandler {
+	return &CategoryHandler{
+		db:       db,
+		validate: validate,
+	}
+}
+
+// Index returns the whole category tree.
+func (ch *CategoryHandler) Index(w http.ResponseWriter, r *http.Request) {
+	rows, err := ch.db.Query("SELECT id, name, slug, parent_id FROM categories ORDER BY name")
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	categories := make([]*domain.Category, 0)
+	byId := make(map[string]*domain.Category)
+	for rows.Next() {
+		category := &domain.Category{Children: make([]*domain.Category, 0)}
+		err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.ParentId)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		categories = append(categories, category)
+		byId[category.ID] = category
+	}
+
+	tree := make([]*domain.Category, 0)
+	for _, category := range categories {
+		if category.ParentId == nil {
+			tree = append(tree, category)
+			continue
+		}
+		if parent, ok := byId[*category.ParentId]; ok {
+			parent.Children = append(parent.Children, category)
+		}
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		tree,
+	))
+}
+
+func (ch *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var data domain.CategoryRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ch.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	if data.ParentId != nil {
+		if apiErr := ch.validateParent(*data.ParentId, ""); apiErr != nil {
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	uuid := uuid.New()
+	if _, err := ch.db.Exec(
+		`INSERT INTO categories (id,name,slug,parent_id,created_at) VALUES ($1,$2,$3,$4,$5)`,
+		uuid, data.Name, data.Slug, data.ParentId, time.Now(),
+	); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "slug is already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"category added successfully",
+		domain.Category{
+			ID:       uuid.String(),
+			Name:     data.Name,
+			Slug:     data.Slug,
+			ParentId: data.ParentId,
+			Children: make([]*domain.Category, 0),
+		},
+	))
+}
+
+func (ch *CategoryHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var data domain.CategoryRequest
+
+	categoryId := chi.URLParam(r, "categoryId")
+	if err := validation.UuidValidation(categoryId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ch.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	if data.ParentId != nil {
+		if apiErr := ch.validateParent(*data.ParentId, categoryId); apiErr != nil {
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	res, err := ch.db.Exec(
+		`UPDATE categories SET name = $1, slug = $2, parent_id = $3 WHERE id = $4`,
+		data.Name, data.Slug, data.ParentId, categoryId,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "slug is already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update category"))
+		return
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		fmt.Println("category not found")
+		response.Error(w, apierror.ClientNotFound("category"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"category updated successfully",
+		domain.Category{
+			ID:       categoryId,
+			Name:     data.Name,
+			Slug:     data.Slug,
+			ParentId: data.ParentId,
+		},
+	))
+}
+
+func (ch *CategoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var children, products int
+
+	categoryId := chi.URLParam(r, "categoryId")
+	if err := validation.UuidValidation(categoryId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ch.db.QueryRow(
+		"SELECT (SELECT count(id) FROM categories WHERE parent_id = $1), (SELECT count(id) FROM products WHERE category_id = $1)",
+		categoryId,
+	).Scan(&children, &products); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if children > 0 || products > 0 {
+		fmt.Println("category is still in use")
+		response.Error(w, apierror.CustomError(http.StatusConflict, "category still has subcategories or products"))
+		return
+	}
+
+	res, err := ch.db.Exec(`DELETE FROM categories WHERE id = $1`, categoryId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete category"))
+		return
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		fmt.Println("category not found")
+		response.Error(w, apierror.ClientNotFound("category"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"category deleted successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: categoryId,
+		},
+	))
+}
+
+// validateParent checks the parent exists, has no products of its own (they
+// belong on leaves only) and is not the category itself or one of its
+// descendants.
+func (ch *CategoryHandler) validateParent(parentId string, categoryId string) *apierror.Error {
+	var exists, isDescendant bool
+	var products int
+
+	if categoryId == "" {
+		categoryId = "00000000-0000-0000-0000-000000000000"
+	}
+
+	err := ch.db.QueryRow(`
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM categories WHERE id = $2
+			UNION ALL
+			SELECT c.id FROM categories c JOIN descendants d ON c.parent_id = d.id
+		)
+		SELECT
+			EXISTS (SELECT 1 FROM categories WHERE id = $1),
+			EXISTS (SELECT 1 FROM descendants WHERE id = $1),
+			(SELECT count(id) FROM products WHERE category_id = $1)`,
+		parentId, categoryId,
+	).Scan(&exists, &isDescendant, &products)
+	if err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if !exists {
+		apiErr := apierror.ClientNotFound("parent category")
+		return &apiErr
+	}
+	if isDescendant {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "category cannot be moved under itself")
+		return &apiErr
+	}
+	if products > 0 {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "parent category already has products")
+		return &apiErr
+	}
+	return nil
+}
+
+// validateLeafCategory checks a product can be assigned to the category.
+func validateLeafCategory(db *sql.DB, categoryId string) *apierror.Error {
+	var exists, hasChildren bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1), EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)",
+		categoryId,
+	).Scan(&exists, &hasChildren)
+	if err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if !exists {
+		apiErr := apierror.ClientNotFound("category")
+		return &apiErr
+	}
+	if hasChildren {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "products can only be assigned to a leaf category")
+		return &apiErr
+	}
+	return nil
+}
+
+// getBreadcrumbs returns the path from the root category down to the given one.
+func getBreadcrumbs(db *sql.DB, categoryId string) ([]domain.Breadcrumb, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE path AS (
+			SELECT id, name, slug, parent_id, 0 AS depth FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.name, c.slug, c.parent_id, p.depth + 1 FROM categories c JOIN path p ON c.id = p.parent_id
+		)
+		SELECT id, name, slug FROM path ORDER BY depth DESC`,
+		categoryId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breadcrumbs := make([]domain.Breadcrumb, 0)
+	for rows.Next() {
+		var breadcrumb domain.Breadcrumb
+		if err := rows.Scan(&breadcrumb.ID, &breadcrumb.Name, &breadcrumb.Slug); err != nil {
+			return nil, err
+		}
+		breadcrumbs = append(breadcrumbs, breadcrumb)
+	}
+	return breadcrumbs, rows.Err()
+}
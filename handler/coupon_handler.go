@@ -0,0 +1,427 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/schema"
+	"github.com/lib/pq"
+)
+
+type CouponHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+}
+
+func NewCouponHandler(db *sql.DB, validate *validator.Validate) *CouponHandler {
+	return &CouponHandler{
+		db:       db,
+		validate: validate,
+	}
+}
+
+const couponColumnsSql = `id, code, seller_id, type, value, currency, min_quantity, product_ids, tags, starts_at, ends_at, usage_limit, per_user_limit, usage_count, created_at`
+
+// Index lists the coupons of the seller.
+func (ch *CouponHandler) Index(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+	ch.index(w, r, &userId)
+}
+
+// PlatformIndex lists the platform coupons.
+func (ch *CouponHandler) PlatformIndex(w http.ResponseWriter, r *http.Request) {
+	ch.index(w, r, nil)
+}
+
+// Create creates a coupon for the products of the seller.
+func (ch *CouponHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+	ch.create(w, r, &userId)
+}
+
+// PlatformCreate creates a coupon for every product.
+func (ch *CouponHandler) PlatformCreate(w http.ResponseWriter, r *http.Request) {
+	ch.create(w, r, nil)
+}
+
+// Delete ends a coupon of the seller, payments keep referring to it.
+func (ch *CouponHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+	ch.delete(w, r, &userId)
+}
+
+// PlatformDelete ends a platform coupon.
+func (ch *CouponHandler) PlatformDelete(w http.ResponseWriter, r *http.Request) {
+	ch.delete(w, r, nil)
+}
+
+func (ch *CouponHandler) index(w http.ResponseWriter, r *http.Request, sellerId *string) {
+	var (
+		filter domain.CouponFilter
+		total  int64
+	)
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ch.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	if err := ch.db.QueryRow(
+		"SELECT count(id) FROM coupons WHERE seller_id IS NOT DISTINCT FROM $1 AND deleted_at IS NULL",
+		sellerId,
+	).Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := ch.db.Query(
+		"SELECT "+couponColumnsSql+" FROM coupons WHERE seller_id IS NOT DISTINCT FROM $1 AND deleted_at IS NULL ORDER BY created_at DESC, id LIMIT $2 OFFSET $3",
+		sellerId, limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	coupons := make([]domain.Coupon, 0)
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		coupons,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
+
+func (ch *CouponHandler) create(w http.ResponseWriter, r *http.Request, sellerId *string) {
+	var data domain.Coupon
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ch.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	if apiErr := validateCoupon(&data); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	// a seller can only scope coupons to their own products
+	if sellerId != nil && len(data.ProductIds) > 0 {
+		var owned int
+		if err := ch.db.QueryRow(
+			"SELECT count(id) FROM products WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL",
+			pq.Array(data.ProductIds), *sellerId,
+		).Scan(&owned); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+
+		if owned != len(data.ProductIds) {
+			fmt.Println("coupon products not owned by seller")
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, "productIds has to be products of the seller"))
+			return
+		}
+	}
+
+	data.ID = uuid.New().String()
+	data.SellerId = sellerId
+	if err := ch.db.QueryRow(
+		`INSERT INTO coupons (id,code,seller_id,type,value,currency,min_quantity,product_ids,tags,starts_at,ends_at,usage_limit,per_user_limit) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13) RETURNING created_at`,
+		data.ID, data.Code, data.SellerId, data.Type, data.Value, data.Currency, data.MinQuantity, pq.Array(data.ProductIds), pq.Array(data.Tags), data.StartsAt, data.EndsAt, data.UsageLimit, data.PerUserLimit,
+	).Scan(&data.CreatedAt); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "coupon code already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"coupon created successfully",
+		data,
+	))
+}
+
+func (ch *CouponHandler) delete(w http.ResponseWriter, r *http.Request, sellerId *string) {
+	couponId := chi.URLParam(r, "couponId")
+	if err := validation.UuidValidation(couponId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	res, err := ch.db.Exec(
+		`UPDATE coupons SET deleted_at = now() WHERE id = $1 AND seller_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL`,
+		couponId, sellerId,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete coupon"))
+		return
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		fmt.Println("coupon not found")
+		response.Error(w, apierror.ClientNotFound("coupon"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"coupon deleted successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: couponId,
+		},
+	))
+}
+
+// validateCoupon normalizes the coupon and checks the rules the validator
+// can not express.
+func validateCoupon(data *domain.Coupon) *apierror.Error {
+	data.Code = strings.ToUpper(data.Code)
+	if data.MinQuantity == 0 {
+		data.MinQuantity = 1
+	}
+	if data.ProductIds == nil {
+		data.ProductIds = make([]string, 0)
+	}
+	if data.Tags == nil {
+		data.Tags = make([]string, 0)
+	}
+
+	switch data.Type {
+	case domain.CouponPercentage:
+		if data.Value > 100 {
+			apiErr := apierror.CustomError(http.StatusBadRequest, "value of a percentage coupon has to be at most 100")
+			return &apiErr
+		}
+	case domain.CouponFreeQuantity:
+		if data.Value >= data.MinQuantity {
+			apiErr := apierror.CustomError(http.StatusBadRequest, "value of a free_quantity coupon has to be lower than minQuantity")
+			return &apiErr
+		}
+	}
+
+	// only fixed amounts are in a currency
+	if data.Type != domain.CouponFixed {
+		data.Currency = nil
+	}
+
+	if data.StartsAt != nil && data.EndsAt != nil && !data.EndsAt.After(*data.StartsAt) {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "endsAt has to be after startsAt")
+		return &apiErr
+	}
+	return nil
+}
+
+func scanCoupon(row interface{ Scan(...interface{}) error }) (domain.Coupon, error) {
+	var coupon domain.Coupon
+	err := row.Scan(&coupon.ID, &coupon.Code, &coupon.SellerId, &coupon.Type, &coupon.Value, &coupon.Currency, &coupon.MinQuantity, pq.Array(&coupon.ProductIds), pq.Array(&coupon.Tags), &coupon.StartsAt, &coupon.EndsAt, &coupon.UsageLimit, &coupon.PerUserLimit, &coupon.UsageCount, &coupon.CreatedAt)
+	return coupon, err
+}
+
+// priceWithCoupon prices data.Quantity at data.UnitPrice and applies the
+// coupon of the payment, if any. A purchase locks the coupon so its usage
+// limits hold under concurrent purchases, a preview only reads it.
+func priceWithCoupon(tx *sql.Tx, data *domain.Payments, forPurchase bool) (*domain.Coupon, *apierror.Error) {
+	subtotal, err := data.UnitPrice.Multiply(data.Quantity)
+	if err != nil {
+		apiErr := apierror.CustomError(http.StatusBadRequest, err.Error())
+		return nil, &apiErr
+	}
+
+	data.Discount = domain.NewMoney(0, subtotal.Currency)
+	data.Total = subtotal
+	if data.CouponCode == nil {
+		return nil, nil
+	}
+
+	lock := ""
+	if forPurchase {
+		lock = " FOR UPDATE"
+	}
+	coupon, err := scanCoupon(tx.QueryRow(
+		"SELECT "+couponColumnsSql+" FROM coupons WHERE code = $1 AND deleted_at IS NULL"+lock,
+		strings.ToUpper(*data.CouponCode),
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			apiErr := apierror.ClientNotFound("coupon")
+			return nil, &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return nil, &apiErr
+	}
+
+	if apiErr := checkCouponApplies(tx, &coupon, data); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var discount domain.Money
+	switch coupon.Type {
+	case domain.CouponPercentage:
+		discount = domain.NewMoney(subtotal.Amount/100*coupon.Value+subtotal.Amount%100*coupon.Value/100, subtotal.Currency)
+	case domain.CouponFixed:
+		discount = domain.NewMoney(coupon.Value, *coupon.Currency)
+		if discount.Amount > subtotal.Amount {
+			discount.Amount = subtotal.Amount
+		}
+	case domain.CouponFreeQuantity:
+		free := data.Quantity / coupon.MinQuantity * coupon.Value
+		discount, err = data.UnitPrice.Multiply(free)
+	}
+	if err == nil {
+		data.Total, err = subtotal.Sub(discount)
+	}
+	if err != nil {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "coupon can not be applied: "+err.Error())
+		return nil, &apiErr
+	}
+
+	data.Discount = discount
+	data.CouponCode = &coupon.Code
+	return &coupon, nil
+}
+
+// checkCouponApplies checks the validity window, the usage limits and the
+// scope of the coupon against the purchase.
+func checkCouponApplies(tx *sql.Tx, coupon *domain.Coupon, data *domain.Payments) *apierror.Error {
+	now := time.Now()
+	if coupon.StartsAt != nil && coupon.StartsAt.After(now) {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "coupon is not valid yet")
+		return &apiErr
+	}
+	if coupon.EndsAt != nil && !coupon.EndsAt.After(now) {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "coupon has expired")
+		return &apiErr
+	}
+	if coupon.UsageLimit != nil && coupon.UsageCount >= *coupon.UsageLimit {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "coupon has been used up")
+		return &apiErr
+	}
+
+	if coupon.PerUserLimit != nil {
+		var used int64
+		if err := tx.QueryRow("SELECT count(id) FROM payments WHERE coupon_id = $1 AND user_id = $2", coupon.ID, data.UserId).Scan(&used); err != nil {
+			apiErr := apierror.CustomServerError(err.Error())
+			return &apiErr
+		}
+		if used >= *coupon.PerUserLimit {
+			apiErr := apierror.CustomError(http.StatusBadRequest, "coupon has been used up for this user")
+			return &apiErr
+		}
+	}
+
+	if data.Quantity < coupon.MinQuantity {
+		apiErr := apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("coupon requires a quantity of at least %d", coupon.MinQuantity))
+		return &apiErr
+	}
+
+	var (
+		sellerId string
+		tags     []string
+	)
+	if err := tx.QueryRow("SELECT user_id, tags FROM products WHERE id = $1", data.ProductId).Scan(&sellerId, pq.Array(&tags)); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	applies := coupon.SellerId == nil || *coupon.SellerId == sellerId
+	if applies && len(coupon.ProductIds) > 0 {
+		applies = false
+		for _, productId := range coupon.ProductIds {
+			if productId == data.ProductId {
+				applies = true
+				break
+			}
+		}
+	}
+	if applies && len(coupon.Tags) > 0 {
+		applies = false
+		for _, tag := range tags {
+			for _, couponTag := range coupon.Tags {
+				if tag == couponTag {
+					applies = true
+				}
+			}
+		}
+	}
+	if !applies {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "coupon does not apply to this product")
+		return &apiErr
+	}
+	return nil
+}
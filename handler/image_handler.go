@@ -2,6 +2,7 @@ package handler
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"fmt"
 	"mime/multipart"
@@ -20,12 +21,14 @@ import (
 )
 
 type ImageHandler struct {
-	v *validator.Validate
+	db *sql.DB
+	v  *validator.Validate
 }
 
-func NewImageHandler(v *validator.Validate) *ImageHandler {
+func NewImageHandler(db *sql.DB, v *validator.Validate) *ImageHandler {
 	return &ImageHandler{
-		v: v,
+		db: db,
+		v:  v,
 	}
 }
 
@@ -59,6 +62,14 @@ func (im *ImageHandler) Store(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// remember who uploaded the image, product galleries only accept our own uploads
+	userId := r.Context().Value("user_id").(string)
+	if _, err := im.db.Exec(`INSERT INTO uploaded_images (url,user_id,created_at) VALUES ($1,$2,$3)`, imageUrl, userId, time.Now()); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to upload image, server error"))
+		return
+	}
+
 	response.GenerateResponse(w, 200, struct {
 		ImageUrl string `json:"imageUrl"`
 	}{
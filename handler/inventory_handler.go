@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/suggest"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/schema"
+)
+
+type InventoryHandler struct {
+	db          *sql.DB
+	validate    *validator.Validate
+	suggestions *suggest.Index
+}
+
+func NewInventoryHandler(db *sql.DB, validate *validator.Validate, suggestions *suggest.Index) *InventoryHandler {
+	return &InventoryHandler{
+		db:          db,
+		validate:    validate,
+		suggestions: suggestions,
+	}
+}
+
+func (ih *InventoryHandler) Adjust(w http.ResponseWriter, r *http.Request) {
+	var data domain.StockAdjustment
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ih.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	if data.Reason == domain.MovementRestock && *data.Quantity < 0 {
+		fmt.Println("restock has to add stock")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "restock quantity has to be positive"))
+		return
+	}
+	if data.Reason == domain.MovementDamage && *data.Quantity > 0 {
+		fmt.Println("damage has to remove stock")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "damage quantity has to be negative"))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(ih.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateStockVariant(ih.db, productId, data.VariantId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	tx, err := ih.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	movement := domain.InventoryMovement{
+		ProductId: productId,
+		VariantId: data.VariantId,
+		Quantity:  *data.Quantity,
+		Reason:    data.Reason,
+		Note:      data.Note,
+	}
+	if apiErr := adjustStock(tx, &movement, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to adjust stock"))
+		return
+	}
+
+	refreshSuggestion(ih.db, ih.suggestions, productId)
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"stock adjusted successfully",
+		movement,
+	))
+}
+
+func (ih *InventoryHandler) Index(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter domain.InventoryMovementFilter
+		total  int64
+	)
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ih.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(ih.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	where := "product_id = $1"
+	args := []interface{}{productId}
+	if filter.VariantId != "" {
+		where += " AND variant_id = $2"
+		args = append(args, filter.VariantId)
+	}
+
+	if err := ih.db.QueryRow("SELECT count(id) FROM inventory_movements WHERE "+where, args...).Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := ih.db.Query(
+		fmt.Sprintf(
+			"SELECT id, product_id, variant_id, quantity, reason, note, stock_after, payment_id, created_at FROM inventory_movements WHERE %s ORDER BY created_at DESC, id LIMIT %d OFFSET %d",
+			where, limit, offset,
+		),
+		args...,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	movements := make([]domain.InventoryMovement, 0)
+	for rows.Next() {
+		var movement domain.InventoryMovement
+		if err := rows.Scan(&movement.ID, &movement.ProductId, &movement.VariantId, &movement.Quantity, &movement.Reason, &movement.Note, &movement.StockAfter, &movement.PaymentId, &movement.CreatedAt); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		movements = append(movements, movement)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		movements,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
+
+// validateStockVariant makes sure stock of a product with variants is only
+// changed through one of its variants.
+func validateStockVariant(db *sql.DB, productId string, variantId *string) *apierror.Error {
+	var (
+		variants     int
+		variantFound bool
+	)
+	if err := db.QueryRow(
+		`SELECT count(id), COALESCE(bool_or(id::text = $2), false) FROM product_variants WHERE product_id = $1`,
+		productId, variantId,
+	).Scan(&variants, &variantFound); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if variants > 0 && variantId == nil {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "variantId is required")
+		return &apiErr
+	}
+
+	if variantId != nil && !variantFound {
+		apiErr := apierror.ClientNotFound("variant")
+		return &apiErr
+	}
+	return nil
+}
+
+// adjustStock changes the stock of the product (or its variant) by
+// movement.Quantity and appends the movement to the ledger. Stock never goes
+// below zero.
+func adjustStock(tx *sql.Tx, movement *domain.InventoryMovement, userId string) *apierror.Error {
+	var row *sql.Row
+	if movement.VariantId != nil {
+		row = tx.QueryRow(
+			`UPDATE product_variants SET stock = stock + $1 WHERE id = $2 AND product_id = $3 AND stock + $1 >= 0 RETURNING stock`,
+			movement.Quantity, *movement.VariantId, movement.ProductId,
+		)
+	} else {
+		row = tx.QueryRow(
+			`UPDATE products SET stock = stock + $1 WHERE id = $2 AND stock + $1 >= 0 RETURNING stock`,
+			movement.Quantity, movement.ProductId,
+		)
+	}
+
+	if err := row.Scan(&movement.StockAfter); err != nil {
+		if err == sql.ErrNoRows {
+			apiErr := apierror.CustomError(http.StatusBadRequest, "insufficient stock")
+			return &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if err := recordMovement(tx, movement, userId); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+	return nil
+}
+
+// recordMovement appends a movement whose stock change was already applied.
+func recordMovement(tx *sql.Tx, movement *domain.InventoryMovement, userId string) error {
+	id := uuid.New()
+	err := tx.QueryRow(
+		`INSERT INTO inventory_movements (id,product_id,variant_id,quantity,reason,note,stock_after,payment_id,user_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING created_at`,
+		id, movement.ProductId, movement.VariantId, movement.Quantity, movement.Reason, movement.Note, movement.StockAfter, movement.PaymentId, userId,
+	).Scan(&movement.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record inventory movement: %w", err)
+	}
+
+	movement.ID = id.String()
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/Croazt/shopifyx/utils/response"
 	apierror "github.com/Croazt/shopifyx/utils/response/error"
 	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/suggest"
 	"github.com/Croazt/shopifyx/utils/validation"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -17,14 +18,16 @@ import (
 )
 
 type PaymentHandler struct {
-	db       *sql.DB
-	validate *validator.Validate
+	db          *sql.DB
+	validate    *validator.Validate
+	suggestions *suggest.Index
 }
 
-func NewPaymentHandler(db *sql.DB, validate *validator.Validate) *PaymentHandler {
+func NewPaymentHandler(db *sql.DB, validate *validator.Validate, suggestions *suggest.Index) *PaymentHandler {
 	return &PaymentHandler{
-		db:       db,
-		validate: validate,
+		db:          db,
+		validate:    validate,
+		suggestions: suggestions,
 	}
 }
 
@@ -65,10 +68,28 @@ func (ph *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid := uuid.New()
+	var live bool
+	if err := ph.db.QueryRow(`SELECT deleted_at IS NULL AND `+productLiveSql+` FROM products WHERE id = $1`, productId).Scan(&live); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("product"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if !live {
+		fmt.Println("product is not live")
+		response.Error(w, apierror.ClientNotFound("product"))
+		return
+	}
+
 	var count int
 	var sellerId string
-	if err := ph.db.QueryRow(`SELECT COUNT(products.id), products.user_id FROM products JOIN bank_accounts ON products.user_id = bank_accounts.user_id WHERE bank_accounts.id = $1 AND products.id = $2 GROUP BY products.user_id`, data.BankAccountId, productId).Scan(&count, &sellerId); err != nil {
+	if err := ph.db.QueryRow(`SELECT COUNT(products.id), products.user_id FROM products JOIN bank_accounts ON products.user_id = bank_accounts.user_id WHERE bank_accounts.id = $1 AND bank_accounts.deleted_at IS NULL AND products.id = $2 GROUP BY products.user_id`, data.BankAccountId, productId).Scan(&count, &sellerId); err != nil && err != sql.ErrNoRows {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
 		return
@@ -80,29 +101,49 @@ func (ph *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := ph.db.Exec(
-		`INSERT INTO payments (id,bank_account_id,payment_proof_image_url,product_id,quantity,user_id) VALUES ($1,$2,$3,$4,$5,$6)`,
-		uuid, data.BankAccountId, data.PaymentProofImageUrl, productId, data.Quantity, userId,
-	); err != nil {
+	// products with variants have to be bought as one of their variants
+	apiErr := validateStockVariant(ph.db, productId, data.VariantId)
+	if apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	tx, err := ph.db.Begin()
+	if err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
 		return
+	}
+	defer tx.Rollback()
 
+	data.ProductId = productId
+	data.UserId = userId
+	if data.ShippingAddress, apiErr = shippingAddress(tx, userId, data.AddressId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
 	}
-	if _, err := ph.db.Exec(`UPDATE users SET product_sold_total = product_sold_total::int + $1 WHERE id = $2`, data.Quantity, sellerId); err != nil {
+
+	if data.UnitPrice, err = purchasePrice(tx, productId, data.VariantId); err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
 		return
 	}
-	if _, err := ph.db.Exec(`UPDATE products SET purchase_count = purchase_count::int + $1 WHERE id = $2`, data.Quantity, productId); err != nil {
+
+	if apiErr := recordPurchase(tx, &data, sellerId, nil); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
 		return
 	}
 
-	data.ID = uuid.String()
-	data.ProductId = productId
-	data.UserId = userId
+	refreshSuggestion(ph.db, ph.suggestions, productId)
 
 	response.Success(w, apisuccess.CustomResponse(
 		http.StatusOK,
@@ -110,3 +151,173 @@ func (ph *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		data,
 	))
 }
+
+// Preview prices a purchase of the product, with the discount of a coupon,
+// without buying it.
+func (ph *PaymentHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	var data domain.PurchasePreview
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ph.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	var live bool
+	if err := ph.db.QueryRow(`SELECT deleted_at IS NULL AND `+productLiveSql+` FROM products WHERE id = $1`, productId).Scan(&live); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("product"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if !live {
+		fmt.Println("product is not live")
+		response.Error(w, apierror.ClientNotFound("product"))
+		return
+	}
+
+	if apiErr := validateStockVariant(ph.db, productId, data.VariantId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	// the preview only reads, it is rolled back in any case
+	tx, err := ph.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	payment := domain.Payments{
+		ProductId:  productId,
+		UserId:     userId,
+		VariantId:  data.VariantId,
+		Quantity:   data.Quantity,
+		CouponCode: data.CouponCode,
+	}
+	if payment.UnitPrice, err = purchasePrice(tx, productId, data.VariantId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if _, apiErr := priceWithCoupon(tx, &payment, false); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	subtotal, err := payment.Total.Add(payment.Discount)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		domain.PurchasePricing{
+			UnitPrice:  payment.UnitPrice,
+			Subtotal:   subtotal,
+			Discount:   payment.Discount,
+			Total:      payment.Total,
+			CouponCode: payment.CouponCode,
+		},
+	))
+}
+
+// purchasePrice is the price a buyer pays for the product, or its variant,
+// right now. The sale price of the product also applies to variants without
+// a price.
+func purchasePrice(tx *sql.Tx, productId string, variantId *string) (domain.Money, error) {
+	var price domain.Money
+	err := tx.QueryRow(
+		`SELECT `+moneySql(`COALESCE(v.price, `+productPriceSql+`)`)+` FROM products LEFT JOIN product_variants v ON v.product_id = products.id AND v.id = $2 WHERE products.id = $1`,
+		productId, variantId,
+	).Scan(&price)
+	return price, err
+}
+
+// recordPurchase inserts the payment at data.UnitPrice less the discount of
+// its coupon, takes the bought quantity out of stock and counts the sale for
+// the product and its seller.
+func recordPurchase(tx *sql.Tx, data *domain.Payments, sellerId string, orderId *string) *apierror.Error {
+	coupon, apiErr := priceWithCoupon(tx, data, true)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	var couponId *string
+	if coupon != nil {
+		couponId = &coupon.ID
+		if _, err := tx.Exec(`UPDATE coupons SET usage_count = usage_count + 1 WHERE id = $1`, coupon.ID); err != nil {
+			apiErr := apierror.CustomServerError(err.Error())
+			return &apiErr
+		}
+	}
+
+	address, err := json.Marshal(data.ShippingAddress)
+	if err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	data.ID = uuid.New().String()
+	data.OrderId = orderId
+	data.Status = domain.PaymentPaid
+	data.Shipment = nil
+	if err := tx.QueryRow(
+		`INSERT INTO payments (id,bank_account_id,payment_proof_image_url,product_id,quantity,user_id,variant_id,unit_price,total,currency,order_id,coupon_id,coupon_code,discount,shipping_address,status) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16) RETURNING created_at`,
+		data.ID, data.BankAccountId, data.PaymentProofImageUrl, data.ProductId, data.Quantity, data.UserId, data.VariantId, data.UnitPrice.Amount, data.Total.Amount, data.Total.Currency, orderId, couponId, data.CouponCode, data.Discount.Amount, address, data.Status,
+	).Scan(&data.CreatedAt); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if apiErr := adjustStock(tx, &domain.InventoryMovement{
+		ProductId: data.ProductId,
+		VariantId: data.VariantId,
+		Quantity:  -data.Quantity,
+		Reason:    domain.MovementPurchase,
+		PaymentId: &data.ID,
+	}, data.UserId); apiErr != nil {
+		return apiErr
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET product_sold_total = product_sold_total::int + $1 WHERE id = $2`, data.Quantity, sellerId); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+	if _, err := tx.Exec(`UPDATE products SET purchase_count = purchase_count::int + $1 WHERE id = $2`, data.Quantity, data.ProductId); err != nil {
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/schema"
+)
+
+// paymentMoneySql selects an amount of the payment as domain.Money.
+func paymentMoneySql(amount string) string {
+	return "json_build_object('amount', payments." + amount + ", 'currency', payments.currency)"
+}
+
+var paymentColumnsSql = `payments.id, payments.bank_account_id, payments.payment_proof_image_url, payments.quantity, payments.variant_id, payments.product_id, payments.user_id,
+	payments.order_id, payments.coupon_code, payments.shipping_address, payments.status, payments.carrier, payments.tracking_number, payments.shipped_at, payments.received_at, payments.created_at,
+	` + paymentMoneySql("unit_price") + `, ` + paymentMoneySql("discount") + `, ` + paymentMoneySql("total")
+
+// Index lists the purchases of the buyer, newest first.
+func (ph *PaymentHandler) Index(w http.ResponseWriter, r *http.Request) {
+	ph.index(w, r, "payments.user_id")
+}
+
+// Sales lists the payments for the products of the seller, newest first.
+func (ph *PaymentHandler) Sales(w http.ResponseWriter, r *http.Request) {
+	ph.index(w, r, "products.user_id")
+}
+
+func (ph *PaymentHandler) index(w http.ResponseWriter, r *http.Request, ownerColumn string) {
+	var (
+		filter domain.PaymentFilter
+		total  int64
+	)
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ph.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	where := ownerColumn + " = $1 AND ($2 = '' OR payments.status = $2)"
+	if err := ph.db.QueryRow(
+		"SELECT count(payments.id) FROM payments JOIN products ON products.id = payments.product_id WHERE "+where,
+		userId, filter.Status,
+	).Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := ph.db.Query(
+		"SELECT "+paymentColumnsSql+" FROM payments JOIN products ON products.id = payments.product_id WHERE "+where+" ORDER BY payments.created_at DESC, payments.id LIMIT $3 OFFSET $4",
+		userId, filter.Status, limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	payments := make([]domain.Payments, 0)
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		payments = append(payments, payment)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		payments,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
+
+// Ship marks a paid payment as shipped, only the seller of the product can
+// ship it.
+func (ph *PaymentHandler) Ship(w http.ResponseWriter, r *http.Request) {
+	var data domain.Shipment
+
+	paymentId := chi.URLParam(r, "paymentId")
+	if err := validation.UuidValidation(paymentId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ph.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ph.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if apiErr := lockPayment(tx, paymentId, "products.user_id", userId, domain.PaymentPaid); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE payments SET status = $1, carrier = $2, tracking_number = $3, shipped_at = now() WHERE id = $4`,
+		domain.PaymentShipped, data.Carrier, data.TrackingNumber, paymentId,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to ship payment"))
+		return
+	}
+
+	ph.respondPayment(w, tx, paymentId, "payment shipped successfully")
+}
+
+// Receive confirms that the buyer received a shipped payment. The order of
+// the payment is closed once all of its payments are received.
+func (ph *PaymentHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	paymentId := chi.URLParam(r, "paymentId")
+	if err := validation.UuidValidation(paymentId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := ph.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if apiErr := lockPayment(tx, paymentId, "payments.user_id", userId, domain.PaymentShipped); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	var orderId *string
+	if err := tx.QueryRow(
+		`UPDATE payments SET status = $1, received_at = now() WHERE id = $2 RETURNING order_id`,
+		domain.PaymentReceived, paymentId,
+	).Scan(&orderId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to receive payment"))
+		return
+	}
+
+	if orderId != nil {
+		if _, err := tx.Exec(
+			`UPDATE orders SET closed_at = now() WHERE id = $1 AND closed_at IS NULL AND NOT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status <> $2)`,
+			*orderId, domain.PaymentReceived,
+		); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	ph.respondPayment(w, tx, paymentId, "payment received successfully")
+}
+
+// lockPayment locks the payment for a change of its status. ownerColumn is
+// the buyer or the seller column allowed to make the change.
+func lockPayment(tx *sql.Tx, paymentId string, ownerColumn string, userId string, status string) *apierror.Error {
+	var ownerId, currentStatus string
+	if err := tx.QueryRow(
+		"SELECT "+ownerColumn+", payments.status FROM payments JOIN products ON products.id = payments.product_id WHERE payments.id = $1 FOR UPDATE OF payments",
+		paymentId,
+	).Scan(&ownerId, &currentStatus); err != nil {
+		if err == sql.ErrNoRows {
+			apiErr := apierror.ClientNotFound("payment")
+			return &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if ownerId != userId {
+		apiErr := apierror.ClientForbidden()
+		return &apiErr
+	}
+
+	if currentStatus != status {
+		apiErr := apierror.CustomError(http.StatusConflict, fmt.Sprintf("payment is %s, it has to be %s", currentStatus, status))
+		return &apiErr
+	}
+	return nil
+}
+
+func (ph *PaymentHandler) respondPayment(w http.ResponseWriter, tx *sql.Tx, paymentId string, message string) {
+	payment, err := scanPayment(tx.QueryRow("SELECT "+paymentColumnsSql+" FROM payments WHERE payments.id = $1", paymentId))
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		message,
+		payment,
+	))
+}
+
+func scanPayment(row interface{ Scan(...interface{}) error }) (domain.Payments, error) {
+	var (
+		payment        domain.Payments
+		address        []byte
+		carrier        sql.NullString
+		trackingNumber sql.NullString
+		shipment       domain.Shipment
+	)
+	err := row.Scan(&payment.ID, &payment.BankAccountId, &payment.PaymentProofImageUrl, &payment.Quantity, &payment.VariantId, &payment.ProductId, &payment.UserId,
+		&payment.OrderId, &payment.CouponCode, &address, &payment.Status, &carrier, &trackingNumber, &shipment.ShippedAt, &shipment.ReceivedAt, &payment.CreatedAt,
+		&payment.UnitPrice, &payment.Discount, &payment.Total)
+	if err != nil {
+		return payment, err
+	}
+
+	// payments made before addresses were recorded have none
+	if address != nil {
+		if err := json.Unmarshal(address, &payment.ShippingAddress); err != nil {
+			return payment, err
+		}
+	}
+
+	if carrier.Valid {
+		shipment.Carrier = carrier.String
+		shipment.TrackingNumber = trackingNumber.String
+		payment.Shipment = &shipment
+	}
+	return payment, nil
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Croazt/shopifyx/domain"
+)
+
+const (
+	facetTagsLimit   = 10
+	facetPriceBucket = 10
+)
+
+// splitFacets accepts both facets=a&facets=b and facets=a,b.
+func splitFacets(facets []string) []string {
+	res := make([]string, 0, len(facets))
+	for _, facet := range facets {
+		for _, f := range strings.Split(facet, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				res = append(res, f)
+			}
+		}
+	}
+	return res
+}
+
+// getFacets counts the requested facets under the listing filters, every
+// facet ignoring its own filter so the sidebar keeps showing the alternatives.
+func (ph *ProductHandler) getFacets(r *http.Request, filter domain.ProductFilter) (*domain.Facets, error) {
+	facets := &domain.Facets{}
+	for _, facet := range filter.Facets {
+		pw, err := getProductWhere(r, filter, facet)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case filterCondition:
+			facets.Condition, err = ph.countFacet(fmt.Sprintf("SELECT condition, count(id) FROM products WHERE %s GROUP BY condition ORDER BY count(id) DESC, condition", pw.sql()), pw.args)
+		case filterTags:
+			facets.Tags, err = ph.countFacet(fmt.Sprintf("SELECT tag, count(id) FROM products, unnest(tags) AS t(tag) WHERE %s GROUP BY tag ORDER BY count(id) DESC, tag LIMIT %d", pw.sql(), facetTagsLimit), pw.args)
+		case filterPrice:
+			facets.Price, err = ph.priceFacet(pw, filterCurrency(filter))
+		case filterStock:
+			facets.Stock = &domain.StockFacet{}
+			err = ph.db.QueryRow(
+				fmt.Sprintf("SELECT count(id) FILTER (WHERE stock > 0), count(id) FILTER (WHERE stock <= 0) FROM products WHERE %s", pw.sql()),
+				pw.args...,
+			).Scan(&facets.Stock.InStock, &facets.Stock.OutOfStock)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return facets, nil
+}
+
+func (ph *ProductHandler) countFacet(query string, args []interface{}) ([]domain.FacetCount, error) {
+	rows, err := ph.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]domain.FacetCount, 0)
+	for rows.Next() {
+		var count domain.FacetCount
+		if err := rows.Scan(&count.Value, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// priceFacet splits the matching price range into equally wide buckets, pw
+// only matches products in the currency of the buckets.
+func (ph *ProductHandler) priceFacet(pw *productWhere, currency string) ([]domain.PriceBucket, error) {
+	var minPrice, maxPrice *int64
+	if err := ph.db.QueryRow(fmt.Sprintf("SELECT min(%[1]s), max(%[1]s) FROM products WHERE %[2]s", productMinPriceSql, pw.sql()), pw.args...).Scan(&minPrice, &maxPrice); err != nil {
+		return nil, err
+	}
+
+	buckets := make([]domain.PriceBucket, 0)
+	if minPrice == nil || maxPrice == nil {
+		return buckets, nil
+	}
+
+	width := (*maxPrice - *minPrice + facetPriceBucket) / facetPriceBucket
+	for i := int64(0); i < facetPriceBucket; i++ {
+		bucketMin := *minPrice + i*width
+		if bucketMin > *maxPrice {
+			break
+		}
+		buckets = append(buckets, domain.PriceBucket{Min: bucketMin, Max: bucketMin + width - 1, Currency: currency})
+	}
+
+	rows, err := ph.db.Query(
+		fmt.Sprintf("SELECT ((%s) - %d) / %d AS bucket, count(id) FROM products WHERE %s GROUP BY bucket", productMinPriceSql, *minPrice, width, pw.sql()),
+		pw.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket, count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		if bucket >= 0 && bucket < int64(len(buckets)) {
+			buckets[bucket].Count = count
+		}
+	}
+	return buckets, rows.Err()
+}
@@ -4,13 +4,19 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/cursor"
+	"github.com/Croazt/shopifyx/utils/mergepatch"
 	"github.com/Croazt/shopifyx/utils/response"
 	apierror "github.com/Croazt/shopifyx/utils/response/error"
 	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/suggest"
 	"github.com/Croazt/shopifyx/utils/validation"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -20,14 +26,16 @@ import (
 )
 
 type ProductHandler struct {
-	db       *sql.DB
-	validate *validator.Validate
+	db          *sql.DB
+	validate    *validator.Validate
+	suggestions *suggest.Index
 }
 
-func NewProductHandler(db *sql.DB, validate *validator.Validate) *ProductHandler {
+func NewProductHandler(db *sql.DB, validate *validator.Validate, suggestions *suggest.Index) *ProductHandler {
 	return &ProductHandler{
-		db:       db,
-		validate: validate,
+		db:          db,
+		validate:    validate,
+		suggestions: suggestions,
 	}
 }
 
@@ -45,6 +53,7 @@ func (ph *ProductHandler) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter.Facets = splitFacets(filter.Facets)
 	if err := ph.validate.Struct(filter); err != nil {
 		validationErrors := err.(validator.ValidationErrors)
 		for _, e := range validationErrors {
@@ -53,21 +62,43 @@ func (ph *ProductHandler) Index(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	*filter.Offset = *filter.Limit * (*filter.Offset)
-	sql, sqlTotal, err := getFilteredSql(r, filter)
+	var c *cursor.Cursor
+	if filter.Cursor != "" {
+		decoded, err := cursor.Decode(filter.Cursor)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		c = &decoded
+		offset := int64(0)
+		filter.Offset = &offset
+	} else {
+		*filter.Offset = *filter.Limit * (*filter.Offset)
+	}
+
+	q, err := getFilteredSql(r, filter, c)
 	if err != nil {
 		fmt.Println(err.Error())
-		response.Error(w, apierror.CustomError(http.StatusForbidden, err.Error()))
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
 		return
 	}
 
-	var count int64
-	if err := ph.db.QueryRow(sqlTotal).Scan(&count); err != nil {
-		fmt.Println(err.Error())
-		response.Error(w, apierror.CustomServerError(err.Error()))
-		return
+	meta := domain.Meta{
+		Limit:  *filter.Limit,
+		Offset: *filter.Offset,
 	}
-	rows, err := ph.db.Query(sql)
+	if !filter.SkipTotal {
+		var count int64
+		if err := ph.db.QueryRow(q.sqlTotal, q.totalArgs...).Scan(&count); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+		meta.Total = &count
+	}
+
+	rows, err := ph.db.Query(q.sql, q.args...)
 	if err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
@@ -75,27 +106,114 @@ func (ph *ProductHandler) Index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := make([]domain.ProductData, 0)
+	sortValues := make([][]json.RawMessage, 0)
 	for rows.Next() {
-		var product domain.ProductData
-		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.ImageUrl, &product.Stock, &product.Condition, pq.Array(&product.Tags), &product.IsPurchasable, &product.PurchaseCount)
+		var (
+			product   domain.ProductData
+			sortValue []byte
+			values    []json.RawMessage
+		)
+		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.OriginalPrice, &product.SaleEndsAt, &product.PriceRange.Min, &product.PriceRange.Max, &product.ImageUrl, &product.Stock, &product.Condition, pq.Array(&product.Tags), &product.IsPurchasable, &product.PurchaseCount, &product.Rating.Average, &product.Rating.Count, &product.CategoryId, &product.Highlight, &sortValue)
 		if err != nil {
 			fmt.Println(err.Error())
 			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
 			return
 		}
+		if err := json.Unmarshal(sortValue, &values); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
 		data = append(data, product)
+		sortValues = append(sortValues, values)
 	}
 	rows.Close()
 
+	hasMore := int64(len(data)) > *filter.Limit
+	if hasMore {
+		data = data[:*filter.Limit]
+		sortValues = sortValues[:*filter.Limit]
+	}
+
+	hasNext, hasPrev := hasMore, c != nil || *filter.Offset > 0
+	if c != nil && c.Direction == cursor.DirectionPrev {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+			sortValues[i], sortValues[j] = sortValues[j], sortValues[i]
+		}
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if len(data) > 0 {
+		if hasNext {
+			next, err := cursor.Encode(cursor.Cursor{Sort: q.sort, Values: sortValues[len(data)-1], Direction: cursor.DirectionNext})
+			if err != nil {
+				fmt.Println(err.Error())
+				response.Error(w, apierror.CustomServerError(err.Error()))
+				return
+			}
+			meta.Next = &next
+		}
+		if hasPrev {
+			prev, err := cursor.Encode(cursor.Cursor{Sort: q.sort, Values: sortValues[0], Direction: cursor.DirectionPrev})
+			if err != nil {
+				fmt.Println(err.Error())
+				response.Error(w, apierror.CustomServerError(err.Error()))
+				return
+			}
+			meta.Prev = &prev
+		}
+	}
+
+	if len(filter.Facets) > 0 {
+		meta.Facets, err = ph.getFacets(r, filter)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
 	response.SuccessMeta(w, apisuccess.IndexResponse(
 		http.StatusOK,
 		"ok",
 		data,
-		domain.Meta{
-			Limit:  *filter.Limit,
-			Offset: *filter.Offset,
-			Total:  count,
-		},
+		meta,
+	))
+}
+
+func (ph *ProductHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	var filter domain.SuggestFilter
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ph.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit := 10
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		ph.suggestions.Suggest(filter.Q, limit),
 	))
 }
 
@@ -118,10 +236,9 @@ func (ph *ProductHandler) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := ph.db.QueryRow(
-		"SELECT id, name, price, image_url, stock, condition, tags, is_purchasable, purchase_count, user_id  FROM products WHERE products.id = $1",
-		productId).
-		Scan(&productData.Product.ID, &productData.Product.Name, &productData.Product.Price, &productData.Product.ImageUrl, &productData.Product.Stock, &productData.Product.Condition, pq.Array(&productData.Product.Tags), &productData.Product.IsPurchasable, &productData.Product.PurchaseCount, &sellerId); err != nil {
+	var err error
+	productData.Product, sellerId, err = getProductData(ph.db, productId)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println(err.Error())
 			response.Error(w, apierror.ClientNotFound("product"))
@@ -133,13 +250,37 @@ func (ph *ProductHandler) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := ph.db.QueryRow("SELECT name, product_sold_total FROM users WHERE id = $1", sellerId).Scan(&productData.Seller.Name, &productData.Seller.ProductSoldTotal); err != nil {
+	// archived and unpublished products stay visible to their seller and to
+	// their buyers
+	if productData.Product.ArchivedAt != nil || !productData.Product.Live {
+		userId, _ := r.Context().Value("user_id").(string)
+
+		var bought bool
+		if userId != "" && userId != sellerId {
+			if err := ph.db.QueryRow(
+				"SELECT EXISTS (SELECT 1 FROM payments WHERE product_id = $1 AND user_id = $2)",
+				productId, userId,
+			).Scan(&bought); err != nil {
+				fmt.Println(err.Error())
+				response.Error(w, apierror.CustomServerError(err.Error()))
+				return
+			}
+		}
+
+		if userId == "" || (userId != sellerId && !bought) {
+			fmt.Println("product is archived or not published")
+			response.Error(w, apierror.ClientNotFound("product"))
+			return
+		}
+	}
+
+	if err := ph.db.QueryRow("SELECT name, product_sold_total, rating_average, rating_count FROM users WHERE id = $1", sellerId).Scan(&productData.Seller.Name, &productData.Seller.ProductSoldTotal, &productData.Seller.Rating.Average, &productData.Seller.Rating.Count); err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError(err.Error()))
 		return
 	}
 
-	rows, err := ph.db.Query("SELECT id, bank_name, bank_account_name, bank_account_number FROM bank_accounts WHERE user_id = $1", sellerId)
+	rows, err := ph.db.Query("SELECT id, bank_name, bank_account_name, bank_account_number FROM bank_accounts WHERE user_id = $1 AND deleted_at IS NULL", sellerId)
 
 	if err != nil {
 		fmt.Println(err.Error())
@@ -160,6 +301,31 @@ func (ph *ProductHandler) Show(w http.ResponseWriter, r *http.Request) {
 		productData.Seller.BankAccounts = append(productData.Seller.BankAccounts, bankAccount)
 	}
 
+	productData.Variants, err = getProductVariants(ph.db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	productData.Images, err = getProductImages(ph.db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	productData.Breadcrumbs = make([]domain.Breadcrumb, 0)
+	if productData.Product.CategoryId != nil {
+		productData.Breadcrumbs, err = getBreadcrumbs(ph.db, *productData.Product.CategoryId)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	w.Header().Set("ETag", productETag(productData.Product.Version))
 	response.Success(w, apisuccess.CustomResponse(
 		http.StatusOK,
 		"ok",
@@ -191,19 +357,66 @@ func (ph *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 		response.Error(w, apierror.CustomError(http.StatusForbidden, "userId not found in context"))
 		return
 	}
+	if apiErr := validateProductSchedule(&data); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateProductSale(&data); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if data.CategoryId != nil {
+		if apiErr := validateLeafCategory(ph.db, *data.CategoryId); apiErr != nil {
+			fmt.Println(apiErr.Message)
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	if apiErr := validateUploadedImage(ph.db, data.ImageUrl, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
 	uuid := uuid.New()
 
-	if _, err := ph.db.Exec(
-		`INSERT INTO products (id,name,price,image_url,stock,condition,is_purchasable,tags,user_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
-		uuid, data.Name, data.Price, data.ImageUrl, data.Stock, data.Condition, data.IsPurchasable, pq.Array(data.Tags), userId,
-	); err != nil {
-		fmt.Println(err)
+	tx, err := ph.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := insertProduct(tx, uuid.String(), data, userId); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "sku already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError("failed to insert data"))
 		return
 	}
 
 	data.ID = uuid.String()
+	if product, _, err := getProductData(ph.db, data.ID); err != nil {
+		fmt.Println(err.Error())
+	} else {
+		ph.suggestions.Upsert(suggestProduct(product))
+	}
 
 	response.Success(w, apisuccess.CustomResponse(
 		http.StatusOK,
@@ -212,10 +425,15 @@ func (ph *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 	))
 }
 
+// Update applies a JSON merge patch (RFC 7396) to the product. The If-Match
+// header is required and compared against the product version to avoid lost
+// updates.
 func (ph *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 	var (
-		data domain.Product
-		id   string
+		current domain.Product
+		data    domain.Product
+		id      string
+		version int64
 	)
 	productId := chi.URLParam(r, "productId")
 	if err := validation.UuidValidation(productId); err != nil {
@@ -224,29 +442,34 @@ func (ph *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		fmt.Println(err.Error())
-		response.Error(w, apierror.ClientBadRequest())
+	if r.Header.Get("If-Match") == "" {
+		err := apierror.ClientPreconditionRequired()
+		fmt.Println(err.Message)
+		response.Error(w, err)
 		return
 	}
 
-	if err := ph.validate.Struct(data); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		for _, e := range validationErrors {
-			fmt.Println(err.Error())
-			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
-			return
-		}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(patch) {
+		fmt.Println("invalid merge patch body")
+		response.Error(w, apierror.ClientBadRequest())
+		return
 	}
 
 	userId := r.Context().Value("user_id").(string)
-	if productId == "" {
-		fmt.Println("userId not found in context")
-		response.Error(w, apierror.ClientBadRequest())
+
+	tx, err := ph.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
 		return
 	}
+	defer tx.Rollback()
 
-	err := ph.db.QueryRow("SELECT user_id FROM products WHERE id = $1", productId).Scan(&id)
+	err = tx.QueryRow(
+		"SELECT user_id, sku, name, "+moneySql("price")+", "+nullMoneySql("sale_price")+", sale_starts_at, sale_ends_at, image_url, stock, condition, tags, is_purchasable, category_id, status, publish_at, unpublish_at, version FROM products WHERE id = $1 AND deleted_at IS NULL FOR UPDATE",
+		productId,
+	).Scan(&id, &current.Sku, &current.Name, &current.Price, &current.SalePrice, &current.SaleStartsAt, &current.SaleEndsAt, &current.ImageUrl, &current.Stock, &current.Condition, pq.Array(&current.Tags), &current.IsPurchasable, &current.CategoryId, &current.Status, &current.PublishAt, &current.UnpublishAt, &version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println(err.Error())
@@ -266,22 +489,110 @@ func (ph *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = ph.db.Exec(
-		`UPDATE products SET name = $1, price = $2, image_url = $3, stock = $4, condition = $5, tags = $6, is_purchasable = $7 WHERE id = $8`,
-		data.Name, data.Price, data.ImageUrl, data.Stock, data.Condition, pq.Array(data.Tags), data.IsPurchasable, productId,
-	)
+	if !matchesIfMatch(r, productETag(version)) {
+		err := apierror.ClientPreconditionFailed()
+		fmt.Println(err.Message)
+		w.Header().Set("ETag", productETag(version))
+		response.Error(w, err)
+		return
+	}
+
+	original, err := json.Marshal(current)
 	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	patched, err := mergepatch.Apply(original, patch)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := json.Unmarshal(patched, &data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := ph.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	if apiErr := validateProductSchedule(&data); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateProductSale(&data); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateProductCurrency(tx, productId, data.Price.Currency); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if data.CategoryId != nil {
+		if apiErr := validateLeafCategory(ph.db, *data.CategoryId); apiErr != nil {
+			fmt.Println(apiErr.Message)
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	// products created before the gallery may keep their external thumbnail
+	if data.ImageUrl != current.ImageUrl {
+		if apiErr := validateUploadedImage(ph.db, data.ImageUrl, userId); apiErr != nil {
+			fmt.Println(apiErr.Message)
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	if err := updateProduct(tx, productId, data, *current.Stock, userId); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "sku already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update product"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError("failed to update product"))
 		return
 	}
 
-	data.ID = productId
+	product, _, err := getProductData(ph.db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	ph.suggestions.Upsert(suggestProduct(product))
 
+	w.Header().Set("ETag", productETag(product.Version))
 	response.Success(w, apisuccess.CustomResponse(
 		http.StatusOK,
 		"product updated successfully",
-		data,
+		product,
 	))
 }
 
@@ -302,7 +613,7 @@ func (ph *ProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := ph.db.QueryRow("SELECT user_id FROM products WHERE id = $1", productId).Scan(&id)
+	err := ph.db.QueryRow("SELECT user_id FROM products WHERE id = $1 AND deleted_at IS NULL", productId).Scan(&id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println(err.Error())
@@ -322,12 +633,15 @@ func (ph *ProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = ph.db.Exec(`DELETE FROM products WHERE id = $1`, productId)
+	// the product is only archived so payments keep pointing at it, it is
+	// purged later when nobody bought it
+	_, err = ph.db.Exec(`UPDATE products SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`, productId)
 	if err != nil {
 		fmt.Println(err.Error())
 		response.Error(w, apierror.CustomServerError("failed to delete product"))
 		return
 	}
+	ph.suggestions.Remove(productId)
 
 	response.Success(w, apisuccess.CustomResponse(
 		http.StatusOK,
@@ -340,6 +654,176 @@ func (ph *ProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	))
 }
 
+func (ph *ProductHandler) Archived(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter domain.ArchivedProductFilter
+		total  int64
+	)
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ph.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if err := ph.db.QueryRow("SELECT count(id) FROM products WHERE user_id = $1 AND deleted_at IS NOT NULL", userId).Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := ph.db.Query(
+		"SELECT id,sku,name,"+moneySql("price")+",image_url,stock,condition,tags,is_purchasable,COALESCE(purchase_count, 0),rating_average,rating_count,"+moneySql("min_price")+","+moneySql("max_price")+",category_id,deleted_at FROM products WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT $2 OFFSET $3",
+		userId, limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	products := make([]domain.ProductData, 0)
+	for rows.Next() {
+		var product domain.ProductData
+		err := rows.Scan(&product.ID, &product.Sku, &product.Name, &product.Price, &product.ImageUrl, &product.Stock, &product.Condition, pq.Array(&product.Tags), &product.IsPurchasable, &product.PurchaseCount, &product.Rating.Average, &product.Rating.Count, &product.PriceRange.Min, &product.PriceRange.Max, &product.CategoryId, &product.ArchivedAt)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		products = append(products, product)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		products,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
+
+func (ph *ProductHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	// authorizeProductSeller does not find archived products
+	var id string
+	userId := r.Context().Value("user_id").(string)
+	if err := ph.db.QueryRow("SELECT user_id FROM products WHERE id = $1", productId).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("product"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if id != userId {
+		err := apierror.ClientForbidden()
+		fmt.Println(err.Message)
+		response.Error(w, err)
+		return
+	}
+
+	res, err := ph.db.Exec(`UPDATE products SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`, productId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "sku is already used by another product"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to restore product"))
+		return
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		fmt.Println("product is not archived")
+		response.Error(w, apierror.ClientNotFound("archived product"))
+		return
+	}
+
+	product, _, err := getProductData(ph.db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	ph.suggestions.Upsert(suggestProduct(product))
+
+	w.Header().Set("ETag", productETag(product.Version))
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"product restored successfully",
+		product,
+	))
+}
+
+// PurgeArchivedProducts deletes products archived longer than retention ago
+// that were never bought, products with payments are kept for the history.
+func PurgeArchivedProducts(db *sql.DB, retention time.Duration) (int64, error) {
+	res, err := db.Exec(
+		`DELETE FROM products WHERE deleted_at < now() - make_interval(secs => $1) AND NOT EXISTS (SELECT 1 FROM payments WHERE payments.product_id = products.id)`,
+		retention.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge archived products: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PurgeArchivedProductsEvery runs PurgeArchivedProducts on every tick of interval.
+func PurgeArchivedProductsEvery(db *sql.DB, retention time.Duration, interval time.Duration) {
+	for range time.Tick(interval) {
+		purged, err := PurgeArchivedProducts(db, retention)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		if purged > 0 {
+			fmt.Printf("purged %d archived products\n", purged)
+		}
+	}
+}
+
 func (ph *ProductHandler) Stock(w http.ResponseWriter, r *http.Request) {
 	var (
 		id    string
@@ -396,62 +880,398 @@ func (ph *ProductHandler) Stock(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Stock{Stock: stock})
 }
 
-func getFilteredSql(r *http.Request, filter domain.ProductFilter) (string, string, error) {
-	sort := "id"
-	if !(filter.SortBy == "") {
-		sort = " ORDER BY " + filter.SortBy
+const (
+	filterCondition = "condition"
+	filterTags      = "tags"
+	filterPrice     = "price"
+	filterStock     = "stock"
+)
+
+type productWhere struct {
+	conds []string
+	args  []interface{}
+	// tsQuery and search are the sql expressions of the search term, empty
+	// when the listing is not searched.
+	tsQuery string
+	search  string
+}
+
+// insertProduct inserts the product along with the first image of its
+// gallery and the initial movement of its stock.
+func insertProduct(tx *sql.Tx, productId string, data domain.Product, userId string) error {
+	if _, err := tx.Exec(
+		`INSERT INTO products (id,sku,name,price,currency,image_url,stock,condition,is_purchasable,tags,user_id,category_id,status,publish_at,unpublish_at,sale_price,sale_starts_at,sale_ends_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)`,
+		productId, data.Sku, data.Name, data.Price.Amount, data.Price.Currency, data.ImageUrl, data.Stock, data.Condition, data.IsPurchasable, pq.Array(data.Tags), userId, data.CategoryId, data.Status, data.PublishAt, data.UnpublishAt, moneyAmount(data.SalePrice), data.SaleStartsAt, data.SaleEndsAt,
+	); err != nil {
+		return err
+	}
+
+	// imageUrl is the first image of the gallery
+	if _, err := tx.Exec(`INSERT INTO product_images (id,product_id,url,position) VALUES ($1,$2,$3,0)`, uuid.New(), productId, data.ImageUrl); err != nil {
+		return err
+	}
+
+	if *data.Stock == 0 {
+		return nil
+	}
+	return recordMovement(tx, &domain.InventoryMovement{
+		ProductId:  productId,
+		Quantity:   *data.Stock,
+		Reason:     domain.MovementInitial,
+		StockAfter: *data.Stock,
+	}, userId)
+}
+
+// updateProduct overwrites the product and bumps its version, keeping the
+// gallery and the stock ledger in line with the new imageUrl and stock.
+func updateProduct(tx *sql.Tx, productId string, data domain.Product, currentStock int64, userId string) error {
+	if _, err := tx.Exec(
+		`UPDATE products SET sku = $1, name = $2, price = $3, currency = $4, image_url = $5, stock = $6, condition = $7, tags = $8, is_purchasable = $9, category_id = $10, status = $11, publish_at = $12, unpublish_at = $13, sale_price = $14, sale_starts_at = $15, sale_ends_at = $16, version = version + 1 WHERE id = $17`,
+		data.Sku, data.Name, data.Price.Amount, data.Price.Currency, data.ImageUrl, data.Stock, data.Condition, pq.Array(data.Tags), data.IsPurchasable, data.CategoryId, data.Status, data.PublishAt, data.UnpublishAt, moneyAmount(data.SalePrice), data.SaleStartsAt, data.SaleEndsAt, productId,
+	); err != nil {
+		return err
+	}
+
+	// imageUrl replaces the first image of the gallery
+	if _, err := tx.Exec(
+		`UPDATE product_images SET url = $1 WHERE id = (SELECT id FROM product_images WHERE product_id = $2 ORDER BY position, created_at LIMIT 1)`,
+		data.ImageUrl, productId,
+	); err != nil {
+		return err
+	}
+
+	if *data.Stock == currentStock {
+		return nil
+	}
+
+	// stock of a product with variants is the sum of its variants, only a
+	// product without variants keeps its own stock in the ledger
+	var hasVariants bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = $1)", productId).Scan(&hasVariants); err != nil {
+		return err
+	}
+	if hasVariants {
+		return nil
+	}
+	return recordMovement(tx, &domain.InventoryMovement{
+		ProductId:  productId,
+		Quantity:   *data.Stock - currentStock,
+		Reason:     domain.MovementCorrection,
+		StockAfter: *data.Stock,
+	}, userId)
+}
+
+// getProductData reads a single product along with the id of its seller.
+func getProductData(db *sql.DB, productId string) (domain.ProductData, string, error) {
+	var (
+		product  domain.ProductData
+		sellerId string
+	)
+
+	err := db.QueryRow(
+		"SELECT id, sku, name, "+productPriceColumnsSql+", image_url, stock, condition, tags, is_purchasable, COALESCE(purchase_count, 0), rating_average, rating_count, category_id, status, publish_at, unpublish_at, "+productLiveSql+", version, deleted_at, user_id FROM products WHERE products.id = $1",
+		productId).
+		Scan(&product.ID, &product.Sku, &product.Name, &product.Price, &product.OriginalPrice, &product.SaleEndsAt, &product.PriceRange.Min, &product.PriceRange.Max, &product.ImageUrl, &product.Stock, &product.Condition, pq.Array(&product.Tags), &product.IsPurchasable, &product.PurchaseCount, &product.Rating.Average, &product.Rating.Count, &product.CategoryId, &product.Status, &product.PublishAt, &product.UnpublishAt, &product.Live, &product.Version, &product.ArchivedAt, &sellerId)
+	return product, sellerId, err
+}
+
+// suggestProduct returns the product as the suggestion index sees it, only
+// listed products that can be bought are suggested.
+func suggestProduct(product domain.ProductData) suggest.Product {
+	return suggest.Product{
+		ID:            product.ID,
+		Name:          product.Name,
+		Tags:          product.Tags,
+		PurchaseCount: product.PurchaseCount,
+		Eligible:      product.IsPurchasable && *product.Stock > 0 && product.Live && product.ArchivedAt == nil && product.Status != domain.ProductStatusUnlisted,
+	}
+}
+
+// refreshSuggestion reloads the product into the suggestion index, e.g. after
+// its stock changed.
+func refreshSuggestion(db *sql.DB, suggestions *suggest.Index, productId string) {
+	product, _, err := getProductData(db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	suggestions.Upsert(suggestProduct(product))
+}
+
+func productETag(version int64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// matchesIfMatch reports whether the If-Match header allows writing over etag.
+func matchesIfMatch(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
 	}
+	return false
+}
+
+func (pw *productWhere) arg(v interface{}) string {
+	pw.args = append(pw.args, v)
+	return fmt.Sprintf("$%d", len(pw.args))
+}
 
-	order := "asc"
-	if !(filter.OrderBy == "") {
-		order = filter.OrderBy
+func (pw *productWhere) sql() string {
+	if len(pw.conds) == 0 {
+		return "TRUE"
 	}
-	where := ""
+	return strings.Join(pw.conds, " AND ")
+}
+
+// getProductWhere builds the listing filters. The filter named by exclude is
+// left out, facets are counted without their own filter.
+func getProductWhere(r *http.Request, filter domain.ProductFilter, exclude string) (*productWhere, error) {
+	pw := &productWhere{conds: []string{"deleted_at IS NULL"}}
+
 	if filter.UserOnly {
 		userId := r.Context().Value("user_id")
 		if userId == nil {
-			return "", "", fmt.Errorf("userOnly filter can be used if you logged in")
+			return nil, fmt.Errorf("userOnly filter can be used if you logged in")
 		}
-		where = fmt.Sprintf("user_id = '%s'", userId)
+		pw.conds = append(pw.conds, "user_id = "+pw.arg(userId))
+
+		if filter.Status != "" {
+			pw.conds = append(pw.conds, "status = "+pw.arg(filter.Status))
+		}
+	} else {
+		pw.conds = append(pw.conds, productListedSql)
 	}
 
-	if len(filter.Tags) > 0 {
-		jsonTag, err := json.Marshal([]string(filter.Tags))
-		if err == nil {
-			replacer := strings.NewReplacer("[", "{", "]", "}")
-			stringTag := replacer.Replace(string(jsonTag))
-			if where != "" {
-				where += fmt.Sprintf(" AND tags && '%s'", stringTag)
-			} else {
-				where = fmt.Sprintf("tags && '%s'", stringTag)
-			}
+	if len(filter.Tags) > 0 && exclude != filterTags {
+		pw.conds = append(pw.conds, "tags && "+pw.arg(pq.Array(filter.Tags))+"::varchar[]")
+	}
+
+	if filter.Category != "" {
+		// a category includes the products of all its descendants
+		pw.conds = append(pw.conds, fmt.Sprintf(`category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE slug = %s
+				UNION ALL
+				SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT id FROM tree)`, pw.arg(filter.Category)))
+	}
+
+	if filter.Condition != "" && exclude != filterCondition {
+		pw.conds = append(pw.conds, "condition = "+pw.arg(filter.Condition))
+	}
+
+	// a product matches when any of its variant prices is in range, prices
+	// are only compared within the currency of the filter
+	if exclude == filterPrice || filter.MinPrice != nil || filter.MaxPrice != nil {
+		pw.conds = append(pw.conds, "currency = "+pw.arg(filterCurrency(filter)))
+	}
+	if exclude != filterPrice {
+		if filter.MinPrice != nil && *filter.MinPrice > -1 {
+			pw.conds = append(pw.conds, "("+productMaxPriceSql+") >= "+pw.arg(*filter.MinPrice))
+		}
+		if filter.MaxPrice != nil && *filter.MaxPrice > -1 {
+			pw.conds = append(pw.conds, "("+productMinPriceSql+") <= "+pw.arg(*filter.MaxPrice))
 		}
 	}
 
-	if filter.Condition != "" {
-		if where != "" {
-			where += fmt.Sprintf(" AND condition = '%s'", filter.Condition)
+	if filter.MinRating != nil {
+		pw.conds = append(pw.conds, "rating_average >= "+pw.arg(*filter.MinRating))
+	}
+
+	if !filter.ShowEmptyStock && exclude != filterStock {
+		pw.conds = append(pw.conds, "stock > 0")
+	}
+
+	if filter.Search != "" {
+		pw.search = pw.arg(filter.Search)
+		pw.tsQuery = "to_tsquery('simple', " + pw.arg(toPrefixTsQuery(filter.Search)) + ")"
+		// full text match on name and tags, trigram similarity on the name
+		// catches typos the full text search misses
+		pw.conds = append(pw.conds, fmt.Sprintf("(search_vector @@ %s OR lower(name) %% lower(%s))", pw.tsQuery, pw.search))
+	}
+
+	return pw, nil
+}
+
+type sortKey struct {
+	name string
+	expr string
+	desc bool
+}
+
+type productQuery struct {
+	sql       string
+	sqlTotal  string
+	args      []interface{}
+	totalArgs []interface{}
+	// sort identifies the ordering, cursors are only valid for the ordering
+	// they were created with.
+	sort string
+}
+
+// productSortKeys maps the sortBy keys to the columns they order by.
+var productSortKeys = map[string]string{
+	"price":         "(" + productMinPriceSql + ")",
+	"date":          "created_at",
+	"purchaseCount": "COALESCE(purchase_count, 0)",
+	"rating":        "rating_average",
+	"name":          "lower(name)",
+	"stock":         "stock",
+}
+
+// getProductSort parses sortBy, a comma separated list of keys with an
+// optional direction, e.g. "price:asc,date:desc". Keys without a direction
+// use orderBy. The id is always the last key so rows with equal sort values
+// keep a stable order.
+func getProductSort(filter domain.ProductFilter, pw *productWhere) ([]sortKey, error) {
+	desc := filter.OrderBy == "desc"
+	keys := make([]sortKey, 0)
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(filter.SortBy, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, dir, hasDir := strings.Cut(part, ":")
+		if seen[name] {
+			return nil, fmt.Errorf("sortBy %s is given more than once", name)
+		}
+		seen[name] = true
+
+		key := sortKey{name: name, desc: desc}
+		if name == "relevance" {
+			if pw.tsQuery == "" {
+				return nil, fmt.Errorf("sortBy relevance requires search")
+			}
+			key.expr = fmt.Sprintf("(ts_rank(search_vector, %s) + similarity(lower(name), lower(%s)))", pw.tsQuery, pw.search)
+			// the most relevant first unless asked otherwise
+			key.desc = filter.OrderBy != "asc"
 		} else {
-			where = fmt.Sprintf("condition = '%s'", filter.Condition)
+			expr, ok := productSortKeys[name]
+			if !ok {
+				return nil, fmt.Errorf("sortBy %s is not supported", name)
+			}
+			key.expr = expr
+		}
+
+		if hasDir {
+			switch dir {
+			case "asc":
+				key.desc = false
+			case "desc":
+				key.desc = true
+			default:
+				return nil, fmt.Errorf("sortBy direction %s is not supported", dir)
+			}
 		}
+		keys = append(keys, key)
 	}
 
-	if *filter.MaxPrice > -1 || *filter.MinPrice > -1 {
-		if where != "" {
-			where += fmt.Sprintf(" AND price >= '%d' AND price <= '%d'", *filter.MinPrice, *filter.MaxPrice)
-		} else {
-			where = fmt.Sprintf("price >= '%d' AND price <= '%d'", *filter.MinPrice, *filter.MaxPrice)
+	return append(keys, sortKey{name: "id", expr: "id", desc: desc}), nil
+}
+
+// getKeysetCondition returns the condition selecting the rows after (or
+// before, for prev cursors) the cursor row in the given ordering.
+func getKeysetCondition(keys []sortKey, placeholders []string, direction string) string {
+	ors := make([]string, 0, len(keys))
+	for i, key := range keys {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = %s", keys[j].expr, placeholders[j]))
 		}
+
+		op := ">"
+		if key.desc != (direction == cursor.DirectionPrev) {
+			op = "<"
+		}
+		ands = append(ands, fmt.Sprintf("%s %s %s", key.expr, op, placeholders[i]))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
 	}
-	if filter.Search != "" {
-		if where != "" {
-			where += " AND name LIKE '%" + filter.Search + "%'"
-		} else {
-			where = "name LIKE '%" + filter.Search + "%'"
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+func getFilteredSql(r *http.Request, filter domain.ProductFilter, c *cursor.Cursor) (productQuery, error) {
+	var q productQuery
+
+	pw, err := getProductWhere(r, filter, "")
+	if err != nil {
+		return q, err
+	}
+	q.sqlTotal = fmt.Sprintf("SELECT count(id) FROM products WHERE %s", pw.sql())
+	q.totalArgs = append([]interface{}{}, pw.args...)
+
+	highlight := "NULL::text"
+	if pw.tsQuery != "" {
+		highlight = fmt.Sprintf("ts_headline('simple', name, %s, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')", pw.tsQuery)
+	}
+
+	keys, err := getProductSort(filter, pw)
+	if err != nil {
+		return q, err
+	}
+	names := make([]string, 0, len(keys))
+	exprs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		dir := "asc"
+		if key.desc {
+			dir = "desc"
 		}
+		names = append(names, key.name+":"+dir)
+		exprs = append(exprs, key.expr)
 	}
+	q.sort = strings.Join(names, ",")
 
-	sql := fmt.Sprintf("SELECT id,name,price,image_url,stock,condition,tags,is_purchasable,purchase_count FROM products WHERE %s ORDER BY %s %s LIMIT %d OFFSET %d", where, sort, order, *filter.Limit, *filter.Offset)
-	sqlTotal := fmt.Sprintf("SELECT count(id) FROM products WHERE %s", where)
-	return sql, sqlTotal, nil
+	direction := cursor.DirectionNext
+	if c != nil {
+		if c.Sort != q.sort || len(c.Values) != len(keys) {
+			return q, fmt.Errorf("cursor does not match the requested sortBy")
+		}
+		values, err := c.Args()
+		if err != nil {
+			return q, err
+		}
+
+		placeholders := make([]string, 0, len(values))
+		for _, v := range values {
+			placeholders = append(placeholders, pw.arg(v))
+		}
+		direction = c.Direction
+		pw.conds = append(pw.conds, getKeysetCondition(keys, placeholders, direction))
+	}
+
+	orders := make([]string, 0, len(keys))
+	for _, key := range keys {
+		// prev pages are read backwards and reversed afterwards
+		desc := key.desc != (direction == cursor.DirectionPrev)
+		order := "asc"
+		if desc {
+			order = "desc"
+		}
+		orders = append(orders, key.expr+" "+order)
+	}
+
+	// one extra row tells whether there is another page
+	q.sql = fmt.Sprintf(
+		"SELECT id,name,%s,image_url,stock,condition,tags,is_purchasable,purchase_count,rating_average,rating_count,category_id,%s,json_build_array(%s) FROM products WHERE %s ORDER BY %s LIMIT %d OFFSET %d",
+		productPriceColumnsSql, highlight, strings.Join(exprs, ","), pw.sql(), strings.Join(orders, ", "), *filter.Limit+1, *filter.Offset,
+	)
+	q.args = pw.args
+	return q, nil
+}
+
+// toPrefixTsQuery turns free text into a tsquery matching every word as a
+// prefix, e.g. "red sho" becomes "red:* & sho:*".
+func toPrefixTsQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
 }
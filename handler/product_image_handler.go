@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const maxProductImages = 8
+
+type ProductImageHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+}
+
+func NewProductImageHandler(db *sql.DB, validate *validator.Validate) *ProductImageHandler {
+	return &ProductImageHandler{
+		db:       db,
+		validate: validate,
+	}
+}
+
+func (pih *ProductImageHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var (
+		data  domain.ProductImage
+		count int
+	)
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := pih.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(pih.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateUploadedImage(pih.db, data.Url, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	tx, err := pih.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// lock the product so concurrent uploads cannot exceed the limit
+	if _, err := tx.Exec("SELECT id FROM products WHERE id = $1 FOR UPDATE", productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := tx.QueryRow("SELECT count(id) FROM product_images WHERE product_id = $1", productId).Scan(&count); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if count >= maxProductImages {
+		fmt.Println("image limit reached")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("a product can have at most %d images", maxProductImages)))
+		return
+	}
+
+	uuid := uuid.New()
+	data.Position = count
+	if _, err := tx.Exec(
+		`INSERT INTO product_images (id,product_id,url,alt_text,position) VALUES ($1,$2,$3,$4,$5)`,
+		uuid, productId, data.Url, data.AltText, data.Position,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	if err := refreshProductThumbnail(tx, productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	data.ID = uuid.String()
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"image added successfully",
+		data,
+	))
+}
+
+// Order sets the gallery order, the body lists every image id of the product
+// in its new order.
+func (pih *ProductImageHandler) Order(w http.ResponseWriter, r *http.Request) {
+	var data domain.ProductImageOrder
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := pih.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(pih.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	tx, err := pih.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	images, err := getProductImages(tx, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	byId := make(map[string]domain.ProductImage, len(images))
+	for _, image := range images {
+		byId[image.ID] = image
+	}
+
+	if len(data.ImageIds) != len(images) {
+		fmt.Println("image ids do not match the product images")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "imageIds has to list every image of the product once"))
+		return
+	}
+
+	ordered := make([]domain.ProductImage, 0, len(images))
+	for position, imageId := range data.ImageIds {
+		image, ok := byId[imageId]
+		if !ok {
+			fmt.Println("image ids do not match the product images")
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, "imageIds has to list every image of the product once"))
+			return
+		}
+		delete(byId, imageId)
+
+		image.Position = position
+		if _, err := tx.Exec(`UPDATE product_images SET position = $1 WHERE id = $2`, position, imageId); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("failed to reorder images"))
+			return
+		}
+		ordered = append(ordered, image)
+	}
+
+	if err := refreshProductThumbnail(tx, productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to reorder images"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to reorder images"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"images reordered successfully",
+		ordered,
+	))
+}
+
+func (pih *ProductImageHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var count int
+
+	productId := chi.URLParam(r, "productId")
+	imageId := chi.URLParam(r, "imageId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err := validation.UuidValidation(imageId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(pih.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	tx, err := pih.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT id FROM products WHERE id = $1 FOR UPDATE", productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := tx.QueryRow("SELECT count(id) FROM product_images WHERE product_id = $1", productId).Scan(&count); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if count <= 1 {
+		fmt.Println("cannot delete the last image")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "a product needs at least one image"))
+		return
+	}
+
+	res, err := tx.Exec(`DELETE FROM product_images WHERE id = $1 AND product_id = $2`, imageId, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete image"))
+		return
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		fmt.Println("image not found")
+		response.Error(w, apierror.ClientNotFound("image"))
+		return
+	}
+
+	// close the gap left by the deleted image
+	if _, err := tx.Exec(`
+		UPDATE product_images SET position = ordered.position
+		FROM (SELECT id, row_number() OVER (ORDER BY position, created_at) - 1 AS position FROM product_images WHERE product_id = $1) ordered
+		WHERE product_images.id = ordered.id`,
+		productId,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete image"))
+		return
+	}
+
+	if err := refreshProductThumbnail(tx, productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete image"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete image"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"image deleted successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: imageId,
+		},
+	))
+}
+
+// validateUploadedImage makes sure url was issued by our own /v1/image upload for this user.
+func validateUploadedImage(db *sql.DB, url string, userId string) *apierror.Error {
+	var uploaded bool
+	if err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM uploaded_images WHERE url = $1 AND user_id = $2)",
+		url, userId,
+	).Scan(&uploaded); err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if !uploaded {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "image has to be uploaded through /v1/image first")
+		return &apiErr
+	}
+	return nil
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getProductImages(q queryer, productId string) ([]domain.ProductImage, error) {
+	rows, err := q.Query(
+		"SELECT id, url, alt_text, position FROM product_images WHERE product_id = $1 ORDER BY position, created_at",
+		productId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make([]domain.ProductImage, 0)
+	for rows.Next() {
+		var image domain.ProductImage
+		if err := rows.Scan(&image.ID, &image.Url, &image.AltText, &image.Position); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// refreshProductThumbnail keeps products.image_url, the listing thumbnail,
+// pointing at the first gallery image.
+func refreshProductThumbnail(tx *sql.Tx, productId string) error {
+	_, err := tx.Exec(
+		`UPDATE products SET image_url = (SELECT url FROM product_images WHERE product_id = $1 ORDER BY position, created_at LIMIT 1) WHERE id = $1`,
+		productId,
+	)
+	return err
+}
@@ -0,0 +1,642 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/suggest"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/schema"
+	"github.com/lib/pq"
+)
+
+const (
+	maxImportSize   = 10 << 20
+	maxImportRows   = 5000
+	maxImportErrors = 1000
+	// importProgressEvery is how many rows are processed between job updates.
+	importProgressEvery = 25
+)
+
+// productCsvHeader are the columns of an exported catalogue, an import needs
+// the same header but may leave out id and the optional columns.
+var productCsvHeader = []string{"id", "sku", "name", "price", "imageUrl", "stock", "condition", "tags", "isPurchasable", "categoryId", "status", "publishAt", "unpublishAt", "salePrice", "saleStartsAt", "saleEndsAt", "currency"}
+
+type ProductImportHandler struct {
+	db          *sql.DB
+	validate    *validator.Validate
+	suggestions *suggest.Index
+}
+
+func NewProductImportHandler(db *sql.DB, validate *validator.Validate, suggestions *suggest.Index) *ProductImportHandler {
+	return &ProductImportHandler{
+		db:          db,
+		validate:    validate,
+		suggestions: suggestions,
+	}
+}
+
+// importRow is a parsed line of the uploaded file, err is set when the line
+// could not be parsed into a product.
+type importRow struct {
+	line    int64
+	product domain.Product
+	err     string
+}
+
+func (pih *ProductImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	var filter domain.ImportFilter
+
+	if err := schema.NewDecoder().Decode(&filter, r.URL.Query()); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := pih.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	format := filter.Format
+	if format == "" {
+		format = importFormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if format == "" {
+		fmt.Println("unknown import format")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "format has to be csv or ndjson"))
+		return
+	}
+
+	mode := filter.Mode
+	if mode == "" {
+		mode = domain.ImportModeCreate
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusRequestEntityTooLarge, fmt.Sprintf("import file can be at most %d bytes", maxImportSize)))
+		return
+	}
+
+	var rows []importRow
+	if format == domain.ImportFormatCsv {
+		rows, err = parseCsvImport(body)
+	} else {
+		rows, err = parseNdjsonImport(body)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("import file has no rows")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "import file has no rows"))
+		return
+	}
+	if len(rows) > maxImportRows {
+		fmt.Println("import file has too many rows")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("import file can have at most %d rows", maxImportRows)))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	job := domain.ImportJob{
+		ID:        uuid.New().String(),
+		Format:    format,
+		Mode:      mode,
+		Status:    domain.ImportStatusPending,
+		TotalRows: int64(len(rows)),
+		Errors:    make([]domain.ImportRowError, 0),
+	}
+
+	if err := pih.db.QueryRow(
+		`INSERT INTO import_jobs (id,user_id,format,mode,status,total_rows) VALUES ($1,$2,$3,$4,$5,$6) RETURNING created_at`,
+		job.ID, userId, job.Format, job.Mode, job.Status, job.TotalRows,
+	).Scan(&job.CreatedAt); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to create import job"))
+		return
+	}
+
+	go pih.run(job, rows, userId)
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusAccepted,
+		"import started",
+		job,
+	))
+}
+
+func (pih *ProductImportHandler) Show(w http.ResponseWriter, r *http.Request) {
+	var (
+		job    domain.ImportJob
+		errors []byte
+	)
+
+	jobId := chi.URLParam(r, "jobId")
+	if err := validation.UuidValidation(jobId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if err := pih.db.QueryRow(
+		`SELECT id, format, mode, status, total_rows, processed_rows, succeeded_rows, failed_rows, errors, created_at, finished_at FROM import_jobs WHERE id = $1 AND user_id = $2`,
+		jobId, userId,
+	).Scan(&job.ID, &job.Format, &job.Mode, &job.Status, &job.TotalRows, &job.ProcessedRows, &job.SucceededRows, &job.FailedRows, &errors, &job.CreatedAt, &job.FinishedAt); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("import job"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := json.Unmarshal(errors, &job.Errors); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		job,
+	))
+}
+
+// Export streams the catalogue of the seller in the format the import accepts.
+func (pih *ProductImportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	var filter domain.ExportFilter
+
+	if err := schema.NewDecoder().Decode(&filter, r.URL.Query()); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := pih.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	format := filter.Format
+	if format == "" {
+		format = domain.ImportFormatCsv
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	rows, err := pih.db.Query(
+		"SELECT id, sku, name, "+moneySql("price")+", image_url, stock, condition, tags, is_purchasable, category_id, status, publish_at, unpublish_at, "+nullMoneySql("sale_price")+", sale_starts_at, sale_ends_at FROM products WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at, id",
+		userId,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	var write func(domain.Product) error
+	if format == domain.ImportFormatCsv {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+
+		writer := csv.NewWriter(w)
+		defer writer.Flush()
+		if err := writer.Write(productCsvHeader); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		write = func(product domain.Product) error {
+			return writer.Write(productCsvRecord(product))
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.ndjson"`)
+
+		encoder := json.NewEncoder(w)
+		write = func(product domain.Product) error {
+			return encoder.Encode(product)
+		}
+	}
+
+	for rows.Next() {
+		var product domain.Product
+		if err := rows.Scan(&product.ID, &product.Sku, &product.Name, &product.Price, &product.ImageUrl, &product.Stock, &product.Condition, pq.Array(&product.Tags), &product.IsPurchasable, &product.CategoryId, &product.Status, &product.PublishAt, &product.UnpublishAt, &product.SalePrice, &product.SaleStartsAt, &product.SaleEndsAt); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		if err := write(product); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// FailUnfinishedImports marks the jobs that were interrupted by a restart.
+func FailUnfinishedImports(db *sql.DB) error {
+	_, err := db.Exec(
+		`UPDATE import_jobs SET status = $1, finished_at = now() WHERE status IN ($2, $3)`,
+		domain.ImportStatusFailed, domain.ImportStatusPending, domain.ImportStatusRunning,
+	)
+	return err
+}
+
+func (pih *ProductImportHandler) run(job domain.ImportJob, rows []importRow, userId string) {
+	job.Status = domain.ImportStatusRunning
+	for i, row := range rows {
+		message := row.err
+		if message == "" {
+			message = pih.importProduct(row.product, job.Mode, userId)
+		}
+
+		job.ProcessedRows++
+		if message == "" {
+			job.SucceededRows++
+		} else {
+			job.FailedRows++
+			if len(job.Errors) < maxImportErrors {
+				job.Errors = append(job.Errors, domain.ImportRowError{Row: row.line, Message: message})
+			}
+		}
+
+		if i%importProgressEvery == 0 {
+			pih.saveJob(job, false)
+		}
+	}
+
+	job.Status = domain.ImportStatusCompleted
+	pih.saveJob(job, true)
+}
+
+func (pih *ProductImportHandler) saveJob(job domain.ImportJob, finished bool) {
+	errors, err := json.Marshal(job.Errors)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	if _, err := pih.db.Exec(
+		`UPDATE import_jobs SET status = $1, processed_rows = $2, succeeded_rows = $3, failed_rows = $4, errors = $5,
+		finished_at = CASE WHEN $6 THEN now() END WHERE id = $7`,
+		job.Status, job.ProcessedRows, job.SucceededRows, job.FailedRows, errors, finished, job.ID,
+	); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// importProduct applies a single row with the same rules as creating or
+// updating a product through the API, it returns why the row failed.
+func (pih *ProductImportHandler) importProduct(data domain.Product, mode string, userId string) string {
+	if err := pih.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			return validation.CustomError(e)
+		}
+	}
+
+	if apiErr := validateProductSchedule(&data); apiErr != nil {
+		return apiErr.Message
+	}
+
+	if apiErr := validateProductSale(&data); apiErr != nil {
+		return apiErr.Message
+	}
+
+	if data.CategoryId != nil {
+		if apiErr := validateLeafCategory(pih.db, *data.CategoryId); apiErr != nil {
+			return apiErr.Message
+		}
+	}
+
+	tx, err := pih.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		return "failed to import product"
+	}
+	defer tx.Rollback()
+
+	var (
+		productId    string
+		imageUrl     string
+		currentStock int64
+	)
+	if mode == domain.ImportModeUpsert && data.Sku != nil {
+		err := tx.QueryRow(
+			"SELECT id, image_url, stock FROM products WHERE user_id = $1 AND sku = $2 AND deleted_at IS NULL FOR UPDATE",
+			userId, *data.Sku,
+		).Scan(&productId, &imageUrl, &currentStock)
+		if err != nil && err != sql.ErrNoRows {
+			fmt.Println(err.Error())
+			return "failed to import product"
+		}
+	}
+
+	if data.ImageUrl != imageUrl {
+		if apiErr := validateUploadedImage(pih.db, data.ImageUrl, userId); apiErr != nil {
+			return apiErr.Message
+		}
+	}
+
+	if productId != "" {
+		if apiErr := validateProductCurrency(tx, productId, data.Price.Currency); apiErr != nil {
+			return apiErr.Message
+		}
+		err = updateProduct(tx, productId, data, currentStock, userId)
+	} else {
+		productId = uuid.New().String()
+		err = insertProduct(tx, productId, data, userId)
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return "sku already exists"
+		}
+
+		fmt.Println(err.Error())
+		return "failed to import product"
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		return "failed to import product"
+	}
+
+	product, _, err := getProductData(pih.db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		return ""
+	}
+	pih.suggestions.Upsert(suggestProduct(product))
+	return ""
+}
+
+func importFormatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return domain.ImportFormatCsv
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		return domain.ImportFormatNdjson
+	}
+	return ""
+}
+
+func parseCsvImport(body []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"name", "price", "imageUrl", "stock", "condition"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %s column", name)
+		}
+	}
+
+	rows := make([]importRow, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			parseErr, ok := err.(*csv.ParseError)
+			if !ok {
+				return nil, fmt.Errorf("failed to read csv: %w", err)
+			}
+			rows = append(rows, importRow{line: int64(parseErr.StartLine), err: parseErr.Err.Error()})
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: int64(line)}
+		row.product, err = productFromCsvRecord(record, columns)
+		if err != nil {
+			row.err = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func productFromCsvRecord(record []string, columns map[string]int) (domain.Product, error) {
+	var product domain.Product
+
+	value := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	product.Name = value("name")
+	product.ImageUrl = value("imageUrl")
+	product.Condition = value("condition")
+
+	if sku := value("sku"); sku != "" {
+		product.Sku = &sku
+	}
+	if categoryId := value("categoryId"); categoryId != "" {
+		product.CategoryId = &categoryId
+	}
+
+	// prices are in minor units of the currency, files without a currency
+	// column are in the default currency
+	currency := strings.ToUpper(value("currency"))
+	if currency == "" {
+		currency = domain.DefaultCurrency
+	}
+
+	if price := value("price"); price != "" {
+		parsed, err := strconv.ParseInt(price, 10, 64)
+		if err != nil {
+			return product, fmt.Errorf("price has to be a number")
+		}
+		product.Price = &domain.Money{Amount: parsed, Currency: currency}
+	}
+
+	if stock := value("stock"); stock != "" {
+		parsed, err := strconv.ParseInt(stock, 10, 64)
+		if err != nil {
+			return product, fmt.Errorf("stock has to be a number")
+		}
+		product.Stock = &parsed
+	}
+
+	if isPurchasable := value("isPurchasable"); isPurchasable != "" {
+		parsed, err := strconv.ParseBool(isPurchasable)
+		if err != nil {
+			return product, fmt.Errorf("isPurchasable has to be true or false")
+		}
+		product.IsPurchasable = parsed
+	}
+
+	product.Status = value("status")
+	if publishAt := value("publishAt"); publishAt != "" {
+		parsed, err := time.Parse(time.RFC3339, publishAt)
+		if err != nil {
+			return product, fmt.Errorf("publishAt has to be an RFC 3339 time")
+		}
+		product.PublishAt = &parsed
+	}
+
+	if unpublishAt := value("unpublishAt"); unpublishAt != "" {
+		parsed, err := time.Parse(time.RFC3339, unpublishAt)
+		if err != nil {
+			return product, fmt.Errorf("unpublishAt has to be an RFC 3339 time")
+		}
+		product.UnpublishAt = &parsed
+	}
+
+	if salePrice := value("salePrice"); salePrice != "" {
+		parsed, err := strconv.ParseInt(salePrice, 10, 64)
+		if err != nil {
+			return product, fmt.Errorf("salePrice has to be a number")
+		}
+		product.SalePrice = &domain.Money{Amount: parsed, Currency: currency}
+	}
+
+	if saleStartsAt := value("saleStartsAt"); saleStartsAt != "" {
+		parsed, err := time.Parse(time.RFC3339, saleStartsAt)
+		if err != nil {
+			return product, fmt.Errorf("saleStartsAt has to be an RFC 3339 time")
+		}
+		product.SaleStartsAt = &parsed
+	}
+
+	if saleEndsAt := value("saleEndsAt"); saleEndsAt != "" {
+		parsed, err := time.Parse(time.RFC3339, saleEndsAt)
+		if err != nil {
+			return product, fmt.Errorf("saleEndsAt has to be an RFC 3339 time")
+		}
+		product.SaleEndsAt = &parsed
+	}
+
+	// tags are separated by a pipe so they fit in a single column
+	product.Tags = make([]string, 0)
+	if tags := value("tags"); tags != "" {
+		product.Tags = strings.Split(tags, "|")
+	}
+	return product, nil
+}
+
+func productCsvRecord(product domain.Product) []string {
+	var sku, categoryId, publishAt, unpublishAt, salePrice, saleStartsAt, saleEndsAt string
+	if product.SalePrice != nil {
+		salePrice = strconv.FormatInt(product.SalePrice.Amount, 10)
+	}
+	if product.SaleStartsAt != nil {
+		saleStartsAt = product.SaleStartsAt.Format(time.RFC3339)
+	}
+	if product.SaleEndsAt != nil {
+		saleEndsAt = product.SaleEndsAt.Format(time.RFC3339)
+	}
+	if product.PublishAt != nil {
+		publishAt = product.PublishAt.Format(time.RFC3339)
+	}
+	if product.UnpublishAt != nil {
+		unpublishAt = product.UnpublishAt.Format(time.RFC3339)
+	}
+	if product.Sku != nil {
+		sku = *product.Sku
+	}
+	if product.CategoryId != nil {
+		categoryId = *product.CategoryId
+	}
+
+	return []string{
+		product.ID,
+		sku,
+		product.Name,
+		strconv.FormatInt(product.Price.Amount, 10),
+		product.ImageUrl,
+		strconv.FormatInt(*product.Stock, 10),
+		product.Condition,
+		strings.Join(product.Tags, "|"),
+		strconv.FormatBool(product.IsPurchasable),
+		categoryId,
+		product.Status,
+		publishAt,
+		unpublishAt,
+		salePrice,
+		saleStartsAt,
+		saleEndsAt,
+		product.Price.Currency,
+	}
+}
+
+func parseNdjsonImport(body []byte) ([]importRow, error) {
+	rows := make([]importRow, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), maxImportSize)
+	for line := int64(1); scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		row := importRow{line: line}
+		if err := json.Unmarshal(text, &row.product); err != nil {
+			row.err = "invalid json"
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ndjson: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/schema"
+)
+
+// productOnSaleSql matches products whose sale price applies right now.
+const productOnSaleSql = `(products.sale_price IS NOT NULL
+	AND (products.sale_starts_at IS NULL OR products.sale_starts_at <= now())
+	AND (products.sale_ends_at IS NULL OR products.sale_ends_at > now()))`
+
+// productPriceSql is the price a buyer pays for the product right now.
+const productPriceSql = `CASE WHEN ` + productOnSaleSql + ` THEN products.sale_price ELSE products.price END`
+
+// moneySql selects the amount as domain.Money in the currency of the product.
+func moneySql(amount string) string {
+	return "json_build_object('amount', " + amount + ", 'currency', products.currency)"
+}
+
+// nullMoneySql is moneySql for an amount that may be NULL.
+func nullMoneySql(amount string) string {
+	return "CASE WHEN " + amount + " IS NOT NULL THEN " + moneySql(amount) + " END"
+}
+
+// productMinPriceSql and productMaxPriceSql are the current price range of the
+// product. Variants without their own price follow the sale of the product.
+// Listings filter and sort on them so they agree with the prices shown.
+const (
+	productMinPriceSql = `CASE WHEN ` + productOnSaleSql + ` THEN COALESCE((SELECT min(COALESCE(v.price, products.sale_price)) FROM product_variants v WHERE v.product_id = products.id), products.sale_price) ELSE products.min_price END`
+	productMaxPriceSql = `CASE WHEN ` + productOnSaleSql + ` THEN COALESCE((SELECT max(COALESCE(v.price, products.sale_price)) FROM product_variants v WHERE v.product_id = products.id), products.sale_price) ELSE products.max_price END`
+)
+
+// productPriceColumnsSql selects the current price, the price before the sale,
+// the end of the sale and the current price range.
+var productPriceColumnsSql = moneySql(productPriceSql) + `,
+	CASE WHEN ` + productOnSaleSql + ` THEN ` + moneySql("products.price") + ` END,
+	CASE WHEN ` + productOnSaleSql + ` THEN products.sale_ends_at END,
+	` + moneySql(productMinPriceSql) + `,
+	` + moneySql(productMaxPriceSql)
+
+// moneyAmount returns the amount to store for the optional money.
+func moneyAmount(money *domain.Money) *int64 {
+	if money == nil {
+		return nil
+	}
+	return &money.Amount
+}
+
+// filterCurrency is the currency of the price filters of a listing.
+func filterCurrency(filter domain.ProductFilter) string {
+	if filter.Currency == "" {
+		return domain.DefaultCurrency
+	}
+	return filter.Currency
+}
+
+// validateProductSale checks that the sale price is a discount and that its
+// window is not empty.
+func validateProductSale(data *domain.Product) *apierror.Error {
+	if data.SalePrice == nil {
+		if data.SaleStartsAt != nil || data.SaleEndsAt != nil {
+			apiErr := apierror.CustomError(http.StatusBadRequest, "salePrice is required with saleStartsAt or saleEndsAt")
+			return &apiErr
+		}
+		return nil
+	}
+
+	if data.SalePrice.Currency != data.Price.Currency {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "salePrice has to be in the currency of price")
+		return &apiErr
+	}
+
+	if data.SalePrice.Amount >= data.Price.Amount {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "salePrice has to be lower than price")
+		return &apiErr
+	}
+
+	if data.SaleStartsAt != nil && data.SaleEndsAt != nil && !data.SaleEndsAt.After(*data.SaleStartsAt) {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "saleEndsAt has to be after saleStartsAt")
+		return &apiErr
+	}
+	return nil
+}
+
+// validateProductCurrency keeps the currency of a product while its variants
+// have their own prices, those prices are in the currency of the product.
+func validateProductCurrency(tx *sql.Tx, productId string, currency string) *apierror.Error {
+	var pricedVariants bool
+	if err := tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM products JOIN product_variants v ON v.product_id = products.id WHERE products.id = $1 AND products.currency <> $2 AND v.price IS NOT NULL)",
+		productId, currency,
+	).Scan(&pricedVariants); err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if pricedVariants {
+		apiErr := apierror.CustomError(http.StatusConflict, "currency can not change while variants have their own price")
+		return &apiErr
+	}
+	return nil
+}
+
+// validateVariantCurrency checks that the own price of a variant is in the
+// currency of its product.
+func validateVariantCurrency(db *sql.DB, productId string, price *domain.Money) *apierror.Error {
+	if price == nil {
+		return nil
+	}
+
+	var currency string
+	if err := db.QueryRow("SELECT currency FROM products WHERE id = $1", productId).Scan(&currency); err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if price.Currency != currency {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "price has to be in the currency of the product, "+currency)
+		return &apiErr
+	}
+	return nil
+}
+
+// PriceHistory lists the price changes of the product, newest first.
+func (ph *ProductHandler) PriceHistory(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter domain.PriceHistoryFilter
+		total  int64
+	)
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := ph.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	var exists bool
+	if err := ph.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM products WHERE id = $1 AND deleted_at IS NULL), (SELECT count(id) FROM product_price_history WHERE product_id = $1)",
+		productId,
+	).Scan(&exists, &total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if !exists {
+		fmt.Println("product not found")
+		response.Error(w, apierror.ClientNotFound("product"))
+		return
+	}
+
+	rows, err := ph.db.Query(
+		"SELECT id, json_build_object('amount', price, 'currency', currency), CASE WHEN sale_price IS NOT NULL THEN json_build_object('amount', sale_price, 'currency', currency) END, sale_starts_at, sale_ends_at, created_at FROM product_price_history WHERE product_id = $1 ORDER BY created_at DESC, id LIMIT $2 OFFSET $3",
+		productId, limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	history := make([]domain.PriceHistory, 0)
+	for rows.Next() {
+		var change domain.PriceHistory
+		if err := rows.Scan(&change.ID, &change.Price, &change.SalePrice, &change.SaleStartsAt, &change.SaleEndsAt, &change.ChangedAt); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		history = append(history, change)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		history,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
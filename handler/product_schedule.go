@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	"github.com/Croazt/shopifyx/utils/suggest"
+)
+
+// productLiveSql matches products the public can reach right now. A scheduled
+// product is live as soon as its publish_at passed, even before the scheduler
+// flipped it to published.
+const productLiveSql = `(products.status IN ('published', 'unlisted') OR (products.status = 'scheduled' AND products.publish_at <= now()))
+	AND (products.unpublish_at IS NULL OR products.unpublish_at > now())`
+
+// productListedSql matches products shown in the public listings, unlisted
+// products are only reachable by their link.
+const productListedSql = `products.status <> 'unlisted' AND ` + productLiveSql
+
+// validateProductSchedule defaults the status of the product and checks its
+// publication window.
+func validateProductSchedule(data *domain.Product) *apierror.Error {
+	if data.Status == "" {
+		data.Status = domain.ProductStatusPublished
+	}
+
+	if data.PublishAt != nil && data.UnpublishAt != nil && !data.UnpublishAt.After(*data.PublishAt) {
+		apiErr := apierror.CustomError(http.StatusBadRequest, "unpublishAt has to be after publishAt")
+		return &apiErr
+	}
+	return nil
+}
+
+// PublishScheduledProducts publishes scheduled products whose publish_at
+// passed and takes products past their unpublish_at back to draft.
+func PublishScheduledProducts(db *sql.DB, suggestions *suggest.Index) error {
+	rows, err := db.Query(
+		`UPDATE products SET status = $1, version = version + 1 WHERE status = $2 AND publish_at <= now() AND deleted_at IS NULL RETURNING id`,
+		domain.ProductStatusPublished, domain.ProductStatusScheduled,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish scheduled products: %w", err)
+	}
+	published, err := scanIds(rows)
+	if err != nil {
+		return fmt.Errorf("failed to publish scheduled products: %w", err)
+	}
+
+	rows, err = db.Query(
+		`UPDATE products SET status = $1, unpublish_at = NULL, version = version + 1 WHERE status <> $1 AND unpublish_at <= now() AND deleted_at IS NULL RETURNING id`,
+		domain.ProductStatusDraft,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unpublish products: %w", err)
+	}
+	unpublished, err := scanIds(rows)
+	if err != nil {
+		return fmt.Errorf("failed to unpublish products: %w", err)
+	}
+
+	for _, productId := range append(published, unpublished...) {
+		refreshSuggestion(db, suggestions, productId)
+	}
+	return nil
+}
+
+// PublishScheduledProductsEvery runs PublishScheduledProducts on every tick of interval.
+func PublishScheduledProductsEvery(db *sql.DB, suggestions *suggest.Index, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := PublishScheduledProducts(db, suggestions); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
+
+func scanIds(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,460 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/suggest"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const maxProductVariants = 100
+
+type ProductVariantHandler struct {
+	db          *sql.DB
+	validate    *validator.Validate
+	suggestions *suggest.Index
+}
+
+func NewProductVariantHandler(db *sql.DB, validate *validator.Validate, suggestions *suggest.Index) *ProductVariantHandler {
+	return &ProductVariantHandler{
+		db:          db,
+		validate:    validate,
+		suggestions: suggestions,
+	}
+}
+
+func (pvh *ProductVariantHandler) Index(w http.ResponseWriter, r *http.Request) {
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	variants, err := getProductVariants(pvh.db, productId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		variants,
+	))
+}
+
+func (pvh *ProductVariantHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var (
+		data  domain.ProductVariant
+		count int
+	)
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := pvh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(pvh.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateVariantCurrency(pvh.db, productId, data.Price); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if data.ImageUrl != nil {
+		if apiErr := validateUploadedImage(pvh.db, *data.ImageUrl, userId); apiErr != nil {
+			fmt.Println(apiErr.Message)
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	if err := pvh.db.QueryRow("SELECT count(id) FROM product_variants WHERE product_id = $1", productId).Scan(&count); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if count >= maxProductVariants {
+		fmt.Println("variant limit reached")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("a product can have at most %d variants", maxProductVariants)))
+		return
+	}
+
+	options, err := json.Marshal(data.Options)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	tx, err := pvh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	uuid := uuid.New()
+	if _, err := tx.Exec(
+		`INSERT INTO product_variants (id,product_id,sku,options,price,stock,image_url) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		uuid, productId, data.Sku, options, moneyAmount(data.Price), data.Stock, data.ImageUrl,
+	); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "variant sku or options already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	data.ID = uuid.String()
+	data.ProductId = productId
+
+	if *data.Stock != 0 {
+		if err := recordMovement(tx, &domain.InventoryMovement{
+			ProductId:  productId,
+			VariantId:  &data.ID,
+			Quantity:   *data.Stock,
+			Reason:     domain.MovementInitial,
+			StockAfter: *data.Stock,
+		}, userId); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("failed to insert data"))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	refreshSuggestion(pvh.db, pvh.suggestions, productId)
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusCreated,
+		"variant added successfully",
+		data,
+	))
+}
+
+func (pvh *ProductVariantHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var data domain.ProductVariant
+
+	productId := chi.URLParam(r, "productId")
+	variantId := chi.URLParam(r, "variantId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err := validation.UuidValidation(variantId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := pvh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(pvh.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if apiErr := validateVariantCurrency(pvh.db, productId, data.Price); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	options, err := json.Marshal(data.Options)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	tx, err := pvh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		stock    int64
+		imageUrl *string
+	)
+	if err := tx.QueryRow("SELECT stock, image_url FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE", variantId, productId).Scan(&stock, &imageUrl); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println("variant not found")
+			response.Error(w, apierror.ClientNotFound("variant"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	// variants created before uploads were required may keep their image
+	if data.ImageUrl != nil && (imageUrl == nil || *imageUrl != *data.ImageUrl) {
+		if apiErr := validateUploadedImage(pvh.db, *data.ImageUrl, userId); apiErr != nil {
+			fmt.Println(apiErr.Message)
+			response.Error(w, *apiErr)
+			return
+		}
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE product_variants SET sku = $1, options = $2, price = $3, stock = $4, image_url = $5 WHERE id = $6 AND product_id = $7`,
+		data.Sku, options, moneyAmount(data.Price), data.Stock, data.ImageUrl, variantId, productId,
+	); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "variant sku or options already exists"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update variant"))
+		return
+	}
+
+	if *data.Stock != stock {
+		if err := recordMovement(tx, &domain.InventoryMovement{
+			ProductId:  productId,
+			VariantId:  &variantId,
+			Quantity:   *data.Stock - stock,
+			Reason:     domain.MovementCorrection,
+			StockAfter: *data.Stock,
+		}, userId); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("failed to update variant"))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update variant"))
+		return
+	}
+
+	refreshSuggestion(pvh.db, pvh.suggestions, productId)
+
+	data.ID = variantId
+	data.ProductId = productId
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"variant updated successfully",
+		data,
+	))
+}
+
+func (pvh *ProductVariantHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	productId := chi.URLParam(r, "productId")
+	variantId := chi.URLParam(r, "variantId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err := validation.UuidValidation(variantId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId := r.Context().Value("user_id").(string)
+	if apiErr := authorizeProductSeller(pvh.db, productId, userId); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	tx, err := pvh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var stock int64
+	if err := tx.QueryRow("SELECT stock FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE", variantId, productId).Scan(&stock); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println("variant not found")
+			response.Error(w, apierror.ClientNotFound("variant"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM product_variants WHERE id = $1 AND product_id = $2`, variantId, productId); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "variant already has payments"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete variant"))
+		return
+	}
+
+	if stock != 0 {
+		if err := recordMovement(tx, &domain.InventoryMovement{
+			ProductId:  productId,
+			VariantId:  &variantId,
+			Quantity:   -stock,
+			Reason:     domain.MovementCorrection,
+			Note:       "variant deleted",
+			StockAfter: 0,
+		}, userId); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("failed to delete variant"))
+			return
+		}
+	}
+
+	// without variants left the product is back to its own stock in the ledger
+	if _, err := tx.Exec(
+		`UPDATE products SET stock = (SELECT COALESCE(sum(quantity), 0) FROM inventory_movements WHERE product_id = $1 AND variant_id IS NULL)
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM product_variants WHERE product_id = $1)`,
+		productId,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete variant"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete variant"))
+		return
+	}
+
+	refreshSuggestion(pvh.db, pvh.suggestions, productId)
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"variant deleted successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: variantId,
+		},
+	))
+}
+
+func getProductVariants(db *sql.DB, productId string) ([]domain.ProductVariant, error) {
+	rows, err := db.Query(
+		"SELECT v.id, v.product_id, v.sku, v.options, "+nullMoneySql("v.price")+", v.stock, v.image_url FROM product_variants v JOIN products ON products.id = v.product_id WHERE v.product_id = $1 ORDER BY v.created_at, v.id",
+		productId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make([]domain.ProductVariant, 0)
+	for rows.Next() {
+		var (
+			variant domain.ProductVariant
+			options []byte
+		)
+		if err := rows.Scan(&variant.ID, &variant.ProductId, &variant.Sku, &options, &variant.Price, &variant.Stock, &variant.ImageUrl); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(options, &variant.Options); err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+// authorizeProductSeller checks the product exists, is not archived and
+// belongs to the user.
+func authorizeProductSeller(db *sql.DB, productId string, userId string) *apierror.Error {
+	var id string
+	err := db.QueryRow("SELECT user_id FROM products WHERE id = $1 AND deleted_at IS NULL", productId).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			apiErr := apierror.ClientNotFound("product")
+			return &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return &apiErr
+	}
+
+	if id != userId {
+		apiErr := apierror.ClientForbidden()
+		return &apiErr
+	}
+	return nil
+}
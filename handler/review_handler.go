@@ -0,0 +1,650 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/schema"
+	"github.com/lib/pq"
+)
+
+// reviewReportThreshold is the number of reports that hides a review until
+// an admin moderates it.
+const reviewReportThreshold = 3
+
+type ReviewHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+}
+
+func NewReviewHandler(db *sql.DB, validate *validator.Validate) *ReviewHandler {
+	return &ReviewHandler{
+		db:       db,
+		validate: validate,
+	}
+}
+
+const reviewColumnsSql = `reviews.id, reviews.product_id, reviews.payment_id, users.name, reviews.rating, reviews.body, reviews.reply, reviews.replied_at,
+	reviews.status, reviews.report_count, reviews.created_at, reviews.updated_at, reviews.moderated_at, reviews.seller_id, reviews.user_id`
+
+// Index lists the visible reviews of a product, newest first.
+func (rh *ReviewHandler) Index(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter domain.ReviewFilter
+		total  int64
+		exists bool
+	)
+
+	productId := chi.URLParam(r, "productId")
+	if err := validation.UuidValidation(productId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := rh.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	if err := rh.db.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = $1 AND deleted_at IS NULL)", productId).Scan(&exists); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	if !exists {
+		fmt.Println("product not found")
+		response.Error(w, apierror.ClientNotFound("product"))
+		return
+	}
+
+	where := "reviews.product_id = $1 AND reviews.status = 'visible' AND ($2::smallint IS NULL OR reviews.rating = $2)"
+	if err := rh.db.QueryRow("SELECT count(reviews.id) FROM reviews WHERE "+where, productId, filter.Rating).Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := rh.db.Query(
+		"SELECT "+reviewColumnsSql+" FROM reviews JOIN users ON users.id = reviews.user_id WHERE "+where+" ORDER BY reviews.created_at DESC, reviews.id LIMIT $3 OFFSET $4",
+		productId, filter.Rating, limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	rh.respondReviews(w, rows, limit, offset, total)
+}
+
+// Reported lists the reviews reported since they were last moderated, the
+// most reported first.
+func (rh *ReviewHandler) Reported(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter domain.ReviewFilter
+		total  int64
+	)
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := rh.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	if err := rh.db.QueryRow("SELECT count(id) FROM reviews WHERE report_count > 0").Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := rh.db.Query(
+		"SELECT "+reviewColumnsSql+" FROM reviews JOIN users ON users.id = reviews.user_id WHERE reviews.report_count > 0 ORDER BY reviews.report_count DESC, reviews.created_at, reviews.id LIMIT $1 OFFSET $2",
+		limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	rh.respondReviews(w, rows, limit, offset, total)
+}
+
+// Create reviews a received payment, a payment is reviewed once by its buyer.
+func (rh *ReviewHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var (
+		data      domain.ReviewCreate
+		productId string
+		sellerId  string
+	)
+
+	paymentId := chi.URLParam(r, "paymentId")
+	if err := validation.UuidValidation(paymentId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := rh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := rh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if apiErr := lockPayment(tx, paymentId, "payments.user_id", userId, domain.PaymentReceived); apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if err := tx.QueryRow(
+		"SELECT products.id, products.user_id FROM payments JOIN products ON products.id = payments.product_id WHERE payments.id = $1",
+		paymentId,
+	).Scan(&productId, &sellerId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	reviewId := uuid.New().String()
+	if _, err := tx.Exec(
+		`INSERT INTO reviews (id, payment_id, product_id, seller_id, user_id, rating, body) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		reviewId, paymentId, productId, sellerId, userId, data.Rating, data.Body,
+	); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusConflict, "payment is already reviewed"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+
+	if err := adjustRating(tx, productId, sellerId, data.Rating, 1); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	respondReview(w, tx, reviewId, http.StatusCreated, "review added successfully")
+}
+
+// Update changes the rating or the body of a review, only its author can
+// change it.
+func (rh *ReviewHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var data domain.ReviewUpdate
+
+	reviewId := chi.URLParam(r, "reviewId")
+	if err := validation.UuidValidation(reviewId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := rh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := rh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	review, apiErr := lockReview(tx, reviewId)
+	if apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if review.UserId != userId {
+		fmt.Println("review belongs to another user")
+		response.Error(w, apierror.ClientForbidden())
+		return
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE reviews SET rating = COALESCE($1, rating), body = COALESCE($2, body), updated_at = now() WHERE id = $3`,
+		data.Rating, data.Body, reviewId,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update review"))
+		return
+	}
+
+	// hidden reviews are not part of the aggregates
+	if data.Rating != nil && review.Status == domain.ReviewVisible {
+		if err := adjustRating(tx, review.ProductId, review.SellerId, *data.Rating-review.Rating, 0); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	respondReview(w, tx, reviewId, http.StatusOK, "review updated successfully")
+}
+
+// Reply sets the reply of the seller to a review, a new reply replaces the
+// previous one.
+func (rh *ReviewHandler) Reply(w http.ResponseWriter, r *http.Request) {
+	var data domain.ReviewReply
+
+	reviewId := chi.URLParam(r, "reviewId")
+	if err := validation.UuidValidation(reviewId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := rh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := rh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	review, apiErr := lockReview(tx, reviewId)
+	if apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	if review.SellerId != userId {
+		fmt.Println("review is for the product of another seller")
+		response.Error(w, apierror.ClientForbidden())
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE reviews SET reply = $1, replied_at = now() WHERE id = $2`, data.Reply, reviewId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to reply to review"))
+		return
+	}
+
+	respondReview(w, tx, reviewId, http.StatusOK, "review replied successfully")
+}
+
+// Report flags a review for moderation, a user reports a review once. A
+// review is hidden once it reaches reviewReportThreshold reports.
+func (rh *ReviewHandler) Report(w http.ResponseWriter, r *http.Request) {
+	var data domain.ReviewReport
+
+	reviewId := chi.URLParam(r, "reviewId")
+	if err := validation.UuidValidation(reviewId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := rh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	tx, err := rh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	review, apiErr := lockReview(tx, reviewId)
+	if apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	// hidden reviews cannot be seen, so they cannot be reported either
+	if review.Status != domain.ReviewVisible {
+		fmt.Println("review is hidden")
+		response.Error(w, apierror.ClientNotFound("review"))
+		return
+	}
+
+	if review.UserId == userId {
+		fmt.Println("user reported their own review")
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, "you cannot report your own review"))
+		return
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO review_reports (review_id, user_id, reason) VALUES ($1, $2, $3) ON CONFLICT (review_id, user_id) DO NOTHING`,
+		reviewId, userId, data.Reason,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to insert data"))
+		return
+	}
+	if reported, _ := res.RowsAffected(); reported == 0 {
+		fmt.Println("review is already reported by the user")
+		response.Error(w, apierror.CustomError(http.StatusConflict, "review is already reported"))
+		return
+	}
+
+	status := domain.ReviewVisible
+	if review.ReportCount+1 >= reviewReportThreshold {
+		status = domain.ReviewHidden
+	}
+
+	if _, err := tx.Exec(`UPDATE reviews SET report_count = report_count + 1, status = $1 WHERE id = $2`, status, reviewId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to report review"))
+		return
+	}
+
+	if status == domain.ReviewHidden {
+		if err := adjustRating(tx, review.ProductId, review.SellerId, -review.Rating, -1); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"review reported successfully",
+		struct {
+			ID string `json:"reviewId"`
+		}{
+			ID: reviewId,
+		},
+	))
+}
+
+// Moderate resolves the reports of a review. hide and restore set whether the
+// review is visible, dismiss keeps it as it is. The reports are cleared in
+// every case.
+func (rh *ReviewHandler) Moderate(w http.ResponseWriter, r *http.Request) {
+	var data domain.ReviewModeration
+
+	reviewId := chi.URLParam(r, "reviewId")
+	if err := validation.UuidValidation(reviewId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := rh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	tx, err := rh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	review, apiErr := lockReview(tx, reviewId)
+	if apiErr != nil {
+		fmt.Println(apiErr.Message)
+		response.Error(w, *apiErr)
+		return
+	}
+
+	status := review.Status
+	switch data.Action {
+	case domain.ModerationHide:
+		status = domain.ReviewHidden
+	case domain.ModerationRestore:
+		status = domain.ReviewVisible
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE reviews SET status = $1, report_count = 0, moderated_at = now() WHERE id = $2`,
+		status, reviewId,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to moderate review"))
+		return
+	}
+
+	if status != review.Status {
+		sum, count := review.Rating, int64(1)
+		if status == domain.ReviewHidden {
+			sum, count = -sum, -count
+		}
+		if err := adjustRating(tx, review.ProductId, review.SellerId, sum, count); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+	}
+
+	respondReview(w, tx, reviewId, http.StatusOK, "review moderated successfully")
+}
+
+func (rh *ReviewHandler) respondReviews(w http.ResponseWriter, rows *sql.Rows, limit int64, offset int64, total int64) {
+	reviews := make([]domain.Review, 0)
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		reviews = append(reviews, review)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		reviews,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
+
+func respondReview(w http.ResponseWriter, tx *sql.Tx, reviewId string, status int, message string) {
+	review, err := scanReview(tx.QueryRow("SELECT "+reviewColumnsSql+" FROM reviews JOIN users ON users.id = reviews.user_id WHERE reviews.id = $1", reviewId))
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		status,
+		message,
+		review,
+	))
+}
+
+// lockReview locks the review for a change.
+func lockReview(tx *sql.Tx, reviewId string) (domain.Review, *apierror.Error) {
+	review, err := scanReview(tx.QueryRow("SELECT "+reviewColumnsSql+" FROM reviews JOIN users ON users.id = reviews.user_id WHERE reviews.id = $1 FOR UPDATE OF reviews", reviewId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			apiErr := apierror.ClientNotFound("review")
+			return review, &apiErr
+		}
+
+		apiErr := apierror.CustomServerError(err.Error())
+		return review, &apiErr
+	}
+	return review, nil
+}
+
+func scanReview(row interface{ Scan(...interface{}) error }) (domain.Review, error) {
+	var review domain.Review
+	err := row.Scan(&review.ID, &review.ProductId, &review.PaymentId, &review.Reviewer, &review.Rating, &review.Body, &review.Reply, &review.RepliedAt,
+		&review.Status, &review.ReportCount, &review.CreatedAt, &review.UpdatedAt, &review.ModeratedAt, &review.SellerId, &review.UserId)
+	return review, err
+}
+
+// adjustRating moves the rating aggregates of the product and of its seller
+// by sum and count, e.g. (rating, 1) when a review becomes visible.
+func adjustRating(tx *sql.Tx, productId string, sellerId string, sum int64, count int64) error {
+	if _, err := tx.Exec(
+		`UPDATE products SET rating_sum = rating_sum + $1, rating_count = rating_count + $2 WHERE id = $3`,
+		sum, count, productId,
+	); err != nil {
+		return fmt.Errorf("failed to update product rating: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE users SET rating_sum = rating_sum + $1, rating_count = rating_count + $2 WHERE id = $3`,
+		sum, count, sellerId,
+	); err != nil {
+		return fmt.Errorf("failed to update seller rating: %w", err)
+	}
+	return nil
+}
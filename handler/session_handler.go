@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/session"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+)
+
+type SessionHandler struct {
+	db       *sql.DB
+	sessions *session.Store
+}
+
+func NewSessionHandler(db *sql.DB, sessions *session.Store) *SessionHandler {
+	return &SessionHandler{
+		db:       db,
+		sessions: sessions,
+	}
+}
+
+func (sh *SessionHandler) Index(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+	sessionId, _ := r.Context().Value("session_id").(string)
+
+	rows, err := sh.db.Query(
+		`SELECT id, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC`,
+		userId, time.Now(),
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	data := make([]domain.Session, 0)
+	for rows.Next() {
+		var s domain.Session
+		err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		s.Current = s.ID == sessionId
+		data = append(data, s)
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"success",
+		data,
+	))
+}
+
+func (sh *SessionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+
+	sessionId := chi.URLParam(r, "sessionId")
+	if err := validation.UuidValidation(sessionId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := sh.sessions.Revoke(sessionId, userId); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("session"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to revoke session"))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"session revoked successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: sessionId,
+		},
+	))
+}
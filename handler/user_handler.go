@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	apisuccess "github.com/Croazt/shopifyx/utils/response/success"
+	"github.com/Croazt/shopifyx/utils/session"
+	"github.com/Croazt/shopifyx/utils/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/schema"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserHandler struct {
+	db       *sql.DB
+	validate *validator.Validate
+	sessions *session.Store
+}
+
+func NewUserHandler(db *sql.DB, validate *validator.Validate, sessions *session.Store) *UserHandler {
+	return &UserHandler{
+		db:       db,
+		validate: validate,
+		sessions: sessions,
+	}
+}
+
+func (uh *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user_id").(string)
+
+	profile, err := uh.findProfile(userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("user"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"ok",
+		profile,
+	))
+}
+
+func (uh *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var data domain.UserProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := uh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	if data.Username != nil {
+		var count int
+		if err := uh.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = $1 AND id != $2", *data.Username, userId).Scan(&count); err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError(err.Error()))
+			return
+		}
+
+		if count > 0 {
+			err := apierror.ClientAlreadyExists()
+			fmt.Println(err.Message)
+			response.Error(w, err)
+			return
+		}
+	}
+
+	_, err := uh.db.Exec(
+		`UPDATE users SET name = COALESCE($1, name), username = COALESCE($2, username), updated_at = $3 WHERE id = $4 AND deleted_at IS NULL`,
+		data.Name, data.Username, time.Now(), userId,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientAlreadyExists())
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to update user"))
+		return
+	}
+
+	profile, err := uh.findProfile(userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"user updated successfully",
+		profile,
+	))
+}
+
+// Delete anonymizes the account instead of deleting the row, payments keep
+// pointing at it so buyers and sellers still see their history.
+func (uh *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var (
+		data     domain.UserDelete
+		password string
+	)
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientBadRequest())
+		return
+	}
+
+	if err := uh.validate.Struct(data); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	userId := r.Context().Value("user_id").(string)
+
+	if err := uh.db.QueryRow("SELECT password FROM users WHERE id = $1 AND deleted_at IS NULL", userId).Scan(&password); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientNotFound("user"))
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(data.Password)); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ClientInvalidCredential())
+		return
+	}
+
+	tx, err := uh.db.Begin()
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	date := time.Now()
+	if _, err := tx.Exec(
+		`UPDATE users SET username = $1, name = 'Deleted user', password = '', deleted_at = $2, updated_at = $2 WHERE id = $3`,
+		"deleted_"+strings.ReplaceAll(userId, "-", ""), date, userId,
+	); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete user"))
+		return
+	}
+
+	// products and bank accounts are archived rather than deleted, payments
+	// keep pointing at them
+	if _, err := tx.Exec(`UPDATE products SET deleted_at = $1, version = version + 1 WHERE user_id = $2 AND deleted_at IS NULL`, date, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete user"))
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE bank_accounts SET deleted_at = $1 WHERE user_id = $2 AND deleted_at IS NULL`, date, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete user"))
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, date, userId); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete user"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError("failed to delete user"))
+		return
+	}
+
+	if err := uh.sessions.RevokeAll(userId); err != nil {
+		fmt.Println(err.Error())
+	}
+
+	response.Success(w, apisuccess.CustomResponse(
+		http.StatusOK,
+		"user deleted successfully",
+		struct {
+			ID string `json:"id"`
+		}{
+			ID: userId,
+		},
+	))
+}
+
+func (uh *UserHandler) Seller(w http.ResponseWriter, r *http.Request) {
+	var (
+		seller   domain.SellerProfile
+		sellerId string
+		filter   domain.SellerFilter
+		total    int64
+	)
+
+	if err := r.ParseForm(); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.ServerError())
+		return
+	}
+
+	if err := schema.NewDecoder().Decode(&filter, r.Form); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := uh.validate.Struct(filter); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		for _, e := range validationErrors {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomError(http.StatusBadRequest, validation.CustomError(e)))
+			return
+		}
+	}
+
+	limit, offset := int64(10), int64(0)
+	if filter.Limit != nil {
+		limit = *filter.Limit
+	}
+	if filter.Offset != nil {
+		offset = *filter.Offset * limit
+	}
+
+	username := chi.URLParam(r, "username")
+	if err := uh.db.QueryRow(
+		"SELECT id, username, name, created_at, product_sold_total, rating_average, rating_count FROM users WHERE username = $1 AND deleted_at IS NULL",
+		username,
+	).Scan(&sellerId, &seller.Username, &seller.Name, &seller.JoinedAt, &seller.ProductSoldTotal, &seller.Rating.Average, &seller.Rating.Count); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.ClientNotFound("seller"))
+			return
+		}
+
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	if err := uh.db.QueryRow("SELECT count(id) FROM products WHERE user_id = $1 AND deleted_at IS NULL AND "+productListedSql, sellerId).Scan(&total); err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+
+	rows, err := uh.db.Query(
+		"SELECT id,name,"+productPriceColumnsSql+",image_url,stock,condition,tags,is_purchasable,purchase_count,rating_average,rating_count FROM products WHERE user_id = $1 AND deleted_at IS NULL AND "+productListedSql+" ORDER BY purchase_count DESC, id LIMIT $2 OFFSET $3",
+		sellerId, limit, offset,
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.Error(w, apierror.CustomServerError(err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	seller.Products = make([]domain.ProductData, 0)
+	for rows.Next() {
+		var product domain.ProductData
+		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.OriginalPrice, &product.SaleEndsAt, &product.PriceRange.Min, &product.PriceRange.Max, &product.ImageUrl, &product.Stock, &product.Condition, pq.Array(&product.Tags), &product.IsPurchasable, &product.PurchaseCount, &product.Rating.Average, &product.Rating.Count)
+		if err != nil {
+			fmt.Println(err.Error())
+			response.Error(w, apierror.CustomServerError("Error scanning row:"+err.Error()))
+			return
+		}
+		seller.Products = append(seller.Products, product)
+	}
+
+	response.SuccessMeta(w, apisuccess.IndexResponse(
+		http.StatusOK,
+		"ok",
+		seller,
+		domain.Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  &total,
+		},
+	))
+}
+
+func (uh *UserHandler) findProfile(userId string) (domain.UserProfile, error) {
+	var profile domain.UserProfile
+	err := uh.db.QueryRow(
+		"SELECT id, username, name, product_sold_total, created_at FROM users WHERE id = $1 AND deleted_at IS NULL",
+		userId,
+	).Scan(&profile.ID, &profile.Username, &profile.Name, &profile.ProductSoldTotal, &profile.CreatedAt)
+	return profile, err
+}
@@ -13,8 +13,15 @@ import (
 
 	"github.com/Croazt/shopifyx/db/connection/postgresql"
 	"github.com/Croazt/shopifyx/db/migrations"
+	"github.com/Croazt/shopifyx/domain"
+	"github.com/Croazt/shopifyx/handler"
 	"github.com/Croazt/shopifyx/middleware"
 	"github.com/Croazt/shopifyx/routes"
+	"github.com/Croazt/shopifyx/utils/clientip"
+	"github.com/Croazt/shopifyx/utils/idempotency"
+	"github.com/Croazt/shopifyx/utils/ratelimit"
+	"github.com/Croazt/shopifyx/utils/session"
+	"github.com/Croazt/shopifyx/utils/suggest"
 	"github.com/Croazt/shopifyx/utils/validation"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -58,15 +65,60 @@ func main() {
 		log.Fatalf("error register custom validation")
 	}
 
+	if value := os.Getenv("DEFAULT_CURRENCY"); value != "" {
+		if err := validate.Var(value, "iso4217"); err != nil {
+			log.Fatalf("error parsing DEFAULT_CURRENCY: %v", err)
+		}
+		domain.DefaultCurrency = value
+	}
+
+	if err := clientip.LoadTrustedProxies(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("error loading trusted proxies: %v", err)
+	}
+
+	if err := routes.LoadRateLimitPolicies(); err != nil {
+		log.Fatalf("error loading rate limit policies: %v", err)
+	}
+	rateLimitStore := ratelimit.NewMemoryStore()
+	sessionStore := session.NewStore(db)
+	idempotencyKeys := idempotency.NewStore(db)
+	go idempotencyKeys.PurgeEvery(time.Hour)
+
+	suggestIndex := suggest.NewIndex()
+	if err := suggestIndex.Load(db); err != nil {
+		log.Fatalf("error loading suggestions: %v", err)
+	}
+	go suggestIndex.RefreshEvery(db, 5*time.Minute)
+	go handler.PublishScheduledProductsEvery(db, suggestIndex, time.Minute)
+
+	if err := handler.FailUnfinishedImports(db); err != nil {
+		log.Fatalf("error failing unfinished imports: %v", err)
+	}
+
+	archiveRetention := 30 * 24 * time.Hour
+	if value := os.Getenv("PRODUCT_ARCHIVE_RETENTION"); value != "" {
+		if archiveRetention, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("error parsing PRODUCT_ARCHIVE_RETENTION: %v", err)
+		}
+	}
+	go handler.PurgeArchivedProductsEvery(db, archiveRetention, time.Hour)
+
 	r := chi.NewRouter()
 
 	r.Handle("/metrics", promhttp.Handler())
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(middleware.PrometheusMiddleware)
-		routes.AuthRoute(r, db, validate)
-		routes.ImageRoute(r, validate)
-		routes.ProductRoute(r, db, validate)
-		routes.BankAccountRoute(r, db, validate)
+		r.Use(middleware.RateLimitMiddleware(rateLimitStore, routes.DefaultPolicy, middleware.KeyByIP))
+		routes.AuthRoute(r, db, validate, rateLimitStore, sessionStore, idempotencyKeys)
+		routes.SellerRoute(r, db, validate, sessionStore)
+		routes.ImageRoute(r, db, validate, rateLimitStore, sessionStore, idempotencyKeys)
+		routes.ProductRoute(r, db, validate, rateLimitStore, sessionStore, suggestIndex, idempotencyKeys)
+		routes.PaymentRoute(r, db, validate, sessionStore, suggestIndex, idempotencyKeys)
+		routes.CartRoute(r, db, validate, rateLimitStore, sessionStore, suggestIndex, idempotencyKeys)
+		routes.CouponRoute(r, db, validate, sessionStore, idempotencyKeys)
+		routes.ReviewRoute(r, db, validate, sessionStore, idempotencyKeys)
+		routes.CategoryRoute(r, db, validate, sessionStore, idempotencyKeys)
+		routes.BankAccountRoute(r, db, validate, sessionStore, idempotencyKeys)
 	})
 
 	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+)
+
+// AdminMiddleware only lets admins through. It has to run after the jwt or
+// auth middleware.
+func AdminMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var isAdmin bool
+			userId, _ := r.Context().Value("user_id").(string)
+			if err := db.QueryRow("SELECT is_admin FROM users WHERE id = $1 AND deleted_at IS NULL", userId).Scan(&isAdmin); err != nil && err != sql.ErrNoRows {
+				fmt.Println(err.Error())
+				response.Error(w, apierror.ServerError())
+				return
+			}
+
+			if !isAdmin {
+				fmt.Println("user is not an admin")
+				response.Error(w, apierror.ClientNotAdmin())
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Croazt/shopifyx/utils/apikey"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	"github.com/Croazt/shopifyx/utils/session"
+	"github.com/lib/pq"
+)
+
+// AuthMiddleware accepts either a Bearer jwt or an api key, given as
+// "Authorization: Bearer sfx_..." or "X-API-Key: sfx_...". Requests made with
+// an api key carry its scopes in the context, jwt requests have every scope.
+func AuthMiddleware(db *sql.DB, sessions *session.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			authHeader := r.Header.Get("Authorization")
+			if key == "" && apikey.IsApiKey(strings.TrimPrefix(authHeader, "Bearer ")) {
+				key = strings.TrimPrefix(authHeader, "Bearer ")
+			}
+
+			if key != "" {
+				userId, scopes, apiErr := authenticateApiKey(db, key)
+				if apiErr != nil {
+					response.Error(w, *apiErr)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), "user_id", userId)
+				ctx = context.WithValue(ctx, "scopes", scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			if authHeader == "" {
+				fmt.Println("token not found")
+				response.Error(w, apierror.CustomError(http.StatusUnauthorized, "token not found"))
+				return
+			}
+
+			claims, apiErr := parseJwt(authHeader)
+			if apiErr != nil {
+				response.Error(w, *apiErr)
+				return
+			}
+
+			if apiErr := checkSession(sessions, claims); apiErr != nil {
+				response.Error(w, *apiErr)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireScope rejects api key requests missing the scope. It has to run
+// after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := r.Context().Value("scopes").([]string)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, s := range scopes {
+				if s == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			fmt.Printf("api key is missing scope %s\n", scope)
+			response.Error(w, apierror.ClientMissingScope(scope))
+		})
+	}
+}
+
+func authenticateApiKey(db *sql.DB, key string) (string, []string, *apierror.Error) {
+	var (
+		id      string
+		userId  string
+		keyHash string
+		scopes  []string
+	)
+
+	prefix, err := apikey.Parse(key)
+	if err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.ClientInvalidToken()
+		return "", nil, &apiErr
+	}
+
+	err = db.QueryRow(
+		"SELECT id, user_id, key_hash, scopes FROM api_keys WHERE prefix = $1 AND revoked_at IS NULL",
+		prefix,
+	).Scan(&id, &userId, &keyHash, pq.Array(&scopes))
+	if err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.ClientInvalidToken()
+		if err != sql.ErrNoRows {
+			apiErr = apierror.ServerError()
+		}
+		return "", nil, &apiErr
+	}
+
+	if !apikey.Compare(key, keyHash) {
+		fmt.Println("api key hash mismatched")
+		apiErr := apierror.ClientInvalidToken()
+		return "", nil, &apiErr
+	}
+
+	// last_used_at is only informational, write it at most once a minute
+	if _, err := db.Exec(
+		"UPDATE api_keys SET last_used_at = now() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')",
+		id,
+	); err != nil {
+		fmt.Println(err.Error())
+	}
+
+	return userId, scopes, nil
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Croazt/shopifyx/utils/idempotency"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize is the largest body that is buffered to fingerprint
+	// the request, it fits the largest body a route accepts, a product import.
+	maxIdempotentBodySize = 10 << 20
+)
+
+// idempotencyRecorder keeps a copy of the response to replay it for retries.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(statusCode int) {
+	rec.statusCode = statusCode
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware makes POST requests sent with an Idempotency-Key
+// header safe to retry: the first response is stored and replayed for every
+// retry with the same key and body. It has to run after the jwt or auth
+// middleware, keys are scoped to the user, and after the scope and rate limit
+// checks of the route so their rejections are not replayed.
+func IdempotencyMiddleware(store *idempotency.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			userId, _ := r.Context().Value("user_id").(string)
+			if r.Method != http.MethodPost || key == "" || userId == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				fmt.Println("idempotency key is too long")
+				response.Error(w, apierror.CustomError(http.StatusBadRequest, fmt.Sprintf("Idempotency-Key has to be at most %d characters", maxIdempotencyKeyLength)))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if err != nil {
+				fmt.Println(err.Error())
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					response.Error(w, apierror.CustomError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body can be at most %d bytes", maxIdempotentBodySize)))
+					return
+				}
+				response.Error(w, apierror.ClientBadRequest())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			stored, err := store.Begin(userId, key, idempotency.Fingerprint(r.Method, r.URL.RequestURI(), body))
+			switch err {
+			case nil:
+			case idempotency.ErrKeyReused:
+				fmt.Println(err.Error())
+				response.Error(w, apierror.ClientIdempotencyKeyReused())
+				return
+			case idempotency.ErrInProgress:
+				fmt.Println(err.Error())
+				response.Error(w, apierror.ClientIdempotencyKeyInProgress())
+				return
+			default:
+				fmt.Println(err.Error())
+				response.Error(w, apierror.ServerError())
+				return
+			}
+
+			if stored != nil {
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.StatusCode)
+				w.Write(stored.Body)
+				return
+			}
+
+			// failed requests did not change anything, they can be retried
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(userId, key); err != nil {
+						fmt.Println(err.Error())
+					}
+				}
+			}()
+
+			rec := &idempotencyRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			// a rate limited request did not run, it is retried with the same key
+			if rec.statusCode == 0 || rec.statusCode == http.StatusTooManyRequests || rec.statusCode >= http.StatusInternalServerError {
+				return
+			}
+
+			if err := store.Complete(userId, key, idempotency.Response{
+				StatusCode:  rec.statusCode,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			}); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			completed = true
+		})
+	}
+}
@@ -9,89 +9,140 @@ import (
 
 	"github.com/Croazt/shopifyx/utils/response"
 	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	"github.com/Croazt/shopifyx/utils/session"
 	"github.com/golang-jwt/jwt"
 )
 
-func JwtMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			fmt.Println("token not found")
-			response.Error(w, apierror.CustomError(http.StatusUnauthorized, "token not found"))
-			return
-		}
+func JwtMiddleware(sessions *session.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				fmt.Println("token not found")
+				response.Error(w, apierror.CustomError(http.StatusUnauthorized, "token not found"))
+				return
+			}
 
-		tokenString := string(authHeader)
-		tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+			claims, apiErr := parseJwt(authHeader)
+			if apiErr != nil {
+				response.Error(w, *apiErr)
+				return
+			}
 
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				fmt.Printf("unexpected signing method: %v \n", t.Header["alg"])
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			if apiErr := checkSession(sessions, claims); apiErr != nil {
+				response.Error(w, *apiErr)
+				return
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 		})
-		if err != nil {
-			validationErr, ok := err.(*jwt.ValidationError)
-			if ok {
-				if validationErr.Errors == jwt.ValidationErrorExpired {
-					fmt.Println(err.Error())
-					response.Error(w, apierror.ClientAccessExpired())
-					return
-				}
+	}
+}
+func OptionalJwtMiddleware(sessions *session.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				next.ServeHTTP(w, r)
+				return
 			}
-			fmt.Println(err.Error())
-			response.Error(w, apierror.ClientInvalidToken())
-			return
-		}
 
-		if !token.Valid {
-			fmt.Println("invalid token claims")
-			response.Error(w, apierror.CustomError(http.StatusUnauthorized, "invalid token claims"))
-			return
-		}
+			tokenString := string(authHeader)
+			tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
-		ctx := context.WithValue(r.Context(), "user_id", token.Claims.(jwt.MapClaims)["user_id"])
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
-	})
-}
-func OptionalJwtMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			next.ServeHTTP(w, r)
-			return
-		}
+			token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+				}
+				return []byte(os.Getenv("JWT_SECRET")), nil
+			})
+			if err != nil {
+				validationErr, ok := err.(*jwt.ValidationError)
+				if ok {
+					if validationErr.Errors == jwt.ValidationErrorExpired {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		tokenString := string(authHeader)
-		tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+			if !token.Valid {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			claims := token.Claims.(jwt.MapClaims)
+			if checkSession(sessions, claims) != nil {
+				next.ServeHTTP(w, r)
+				return
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 		})
-		if err != nil {
-			validationErr, ok := err.(*jwt.ValidationError)
-			if ok {
-				if validationErr.Errors == jwt.ValidationErrorExpired {
-					next.ServeHTTP(w, r)
-					return
-				}
+	}
+}
+
+func parseJwt(authHeader string) (jwt.MapClaims, *apierror.Error) {
+	tokenString := string(authHeader)
+	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			fmt.Printf("unexpected signing method: %v \n", t.Header["alg"])
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil {
+		validationErr, ok := err.(*jwt.ValidationError)
+		if ok {
+			if validationErr.Errors == jwt.ValidationErrorExpired {
+				fmt.Println(err.Error())
+				apiErr := apierror.ClientAccessExpired()
+				return nil, &apiErr
 			}
-			next.ServeHTTP(w, r)
-			return
 		}
+		fmt.Println(err.Error())
+		apiErr := apierror.ClientInvalidToken()
+		return nil, &apiErr
+	}
 
-		if !token.Valid {
-			next.ServeHTTP(w, r)
-			return
-		}
+	if !token.Valid {
+		fmt.Println("invalid token claims")
+		apiErr := apierror.CustomError(http.StatusUnauthorized, "invalid token claims")
+		return nil, &apiErr
+	}
 
-		ctx := context.WithValue(r.Context(), "user_id", token.Claims.(jwt.MapClaims)["user_id"])
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
-	})
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+// checkSession rejects tokens whose session (the jti claim) was revoked.
+func checkSession(sessions *session.Store, claims jwt.MapClaims) *apierror.Error {
+	sessionId, _ := claims["jti"].(string)
+	userId, _ := claims["user_id"].(string)
+	if sessionId == "" {
+		fmt.Println("token has no session")
+		apiErr := apierror.ClientInvalidToken()
+		return &apiErr
+	}
+
+	active, err := sessions.IsActive(sessionId, userId)
+	if err != nil {
+		fmt.Println(err.Error())
+		apiErr := apierror.ServerError()
+		return &apiErr
+	}
+	if !active {
+		fmt.Println("session is revoked")
+		apiErr := apierror.ClientAccessExpired()
+		return &apiErr
+	}
+	return nil
+}
+
+func withClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	ctx = context.WithValue(ctx, "user_id", claims["user_id"])
+	return context.WithValue(ctx, "session_id", claims["jti"])
 }
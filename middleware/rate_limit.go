@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Croazt/shopifyx/utils/clientip"
+	"github.com/Croazt/shopifyx/utils/ratelimit"
+	"github.com/Croazt/shopifyx/utils/response"
+	apierror "github.com/Croazt/shopifyx/utils/response/error"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "shopifyx_rate_limited_total",
+	Help: "Number of requests rejected by the rate limiter.",
+}, []string{"policy"})
+
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByIP limits by the client IP.
+func KeyByIP(r *http.Request) string {
+	return "ip:" + clientip.FromRequest(r)
+}
+
+// KeyByUser limits by the authenticated user and falls back to the client IP
+// for anonymous requests.
+func KeyByUser(r *http.Request) string {
+	if userId, ok := r.Context().Value("user_id").(string); ok && userId != "" {
+		return "user:" + userId
+	}
+	return KeyByIP(r)
+}
+
+func RateLimitMiddleware(store ratelimit.Store, policy ratelimit.Policy, keyFunc RateLimitKeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := store.Take(keyFunc(r), policy)
+			if err != nil {
+				// fail open, the limiter must not take the api down
+				fmt.Println(err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(res.Reset.Seconds())))
+
+			if !res.Allowed {
+				fmt.Printf("rate limit %s exceeded\n", policy.Name)
+				rateLimited.WithLabelValues(policy.Name).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+				response.Error(w, apierror.ClientTooManyRequests())
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
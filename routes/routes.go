@@ -2,59 +2,261 @@ package routes
 
 import (
 	"database/sql"
+	"time"
 
+	"github.com/Croazt/shopifyx/domain"
 	"github.com/Croazt/shopifyx/handler"
 	"github.com/Croazt/shopifyx/middleware"
+	"github.com/Croazt/shopifyx/utils/idempotency"
+	"github.com/Croazt/shopifyx/utils/ratelimit"
+	"github.com/Croazt/shopifyx/utils/session"
+	"github.com/Croazt/shopifyx/utils/suggest"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 )
 
-func AuthRoute(r chi.Router, db *sql.DB, validator *validator.Validate) {
-	authHandler := handler.NewAuthHandler(db, validator)
+var (
+	DefaultPolicy  = ratelimit.Policy{Name: "default", Limit: 300, Period: time.Minute}
+	RegisterPolicy = ratelimit.Policy{Name: "register", Limit: 5, Period: time.Hour}
+	LoginPolicy    = ratelimit.Policy{Name: "login", Limit: 20, Period: time.Minute}
+	ImagePolicy    = ratelimit.Policy{Name: "image", Limit: 30, Period: time.Minute}
+	BuyPolicy      = ratelimit.Policy{Name: "buy", Limit: 10, Period: time.Minute}
+)
+
+// LoadRateLimitPolicies applies the RATE_LIMIT_* env overrides to the policies.
+func LoadRateLimitPolicies() error {
+	policies := map[string]*ratelimit.Policy{
+		"RATE_LIMIT_DEFAULT":  &DefaultPolicy,
+		"RATE_LIMIT_REGISTER": &RegisterPolicy,
+		"RATE_LIMIT_LOGIN":    &LoginPolicy,
+		"RATE_LIMIT_IMAGE":    &ImagePolicy,
+		"RATE_LIMIT_BUY":      &BuyPolicy,
+	}
+	for env, policy := range policies {
+		p, err := ratelimit.PolicyFromEnv(env, *policy)
+		if err != nil {
+			return err
+		}
+		*policy = p
+	}
+	return nil
+}
+
+func AuthRoute(r chi.Router, db *sql.DB, validator *validator.Validate, store ratelimit.Store, sessions *session.Store, idempotencyKeys *idempotency.Store) {
+	authHandler := handler.NewAuthHandler(db, validator, sessions)
 	r.Route("/user", func(r chi.Router) {
-		r.Post("/register", authHandler.Register)
-		r.Post("/login", authHandler.Login)
+		r.With(middleware.RateLimitMiddleware(store, RegisterPolicy, middleware.KeyByIP)).Post("/register", authHandler.Register)
+		r.With(middleware.RateLimitMiddleware(store, LoginPolicy, middleware.KeyByIP)).Post("/login", authHandler.Login)
+		r.With(middleware.RateLimitMiddleware(store, LoginPolicy, middleware.KeyByIP)).Post("/refresh", authHandler.Refresh)
+
+		apiKeyHandler := handler.NewApiKeyHandler(db, validator)
+		r.Route("/api-keys", func(r chi.Router) {
+			// api keys cannot be used to manage api keys
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Use(middleware.IdempotencyMiddleware(idempotencyKeys))
+			r.Get("/", apiKeyHandler.Index)
+			r.Post("/", apiKeyHandler.Create)
+			r.Delete("/{apiKeyId}", apiKeyHandler.Delete)
+		})
+
+		userHandler := handler.NewUserHandler(db, validator, sessions)
+		r.Route("/me", func(r chi.Router) {
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Get("/", userHandler.Me)
+			r.Patch("/", userHandler.Update)
+			r.Delete("/", userHandler.Delete)
+		})
+
+		addressHandler := handler.NewAddressHandler(db, validator)
+		r.Route("/addresses", func(r chi.Router) {
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Use(middleware.IdempotencyMiddleware(idempotencyKeys))
+			r.Get("/", addressHandler.Index)
+			r.Post("/", addressHandler.Create)
+			r.Patch("/{addressId}", addressHandler.Update)
+			r.Delete("/{addressId}", addressHandler.Delete)
+		})
+
+		sessionHandler := handler.NewSessionHandler(db, sessions)
+		r.Route("/sessions", func(r chi.Router) {
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Get("/", sessionHandler.Index)
+			r.Delete("/{sessionId}", sessionHandler.Delete)
+		})
 	})
 }
 
-func ImageRoute(r chi.Router, validator *validator.Validate) {
-	imageHandler := handler.NewImageHandler(validator)
+func SellerRoute(r chi.Router, db *sql.DB, validator *validator.Validate, sessions *session.Store) {
+	userHandler := handler.NewUserHandler(db, validator, sessions)
+	r.Get("/seller/{username}", userHandler.Seller)
+}
+
+func ImageRoute(r chi.Router, db *sql.DB, validator *validator.Validate, store ratelimit.Store, sessions *session.Store, idempotencyKeys *idempotency.Store) {
+	imageHandler := handler.NewImageHandler(db, validator)
 	r.Route("/image", func(r chi.Router) {
-		r.Use(middleware.JwtMiddleware)
+		r.Use(middleware.AuthMiddleware(db, sessions))
+		r.Use(middleware.RequireScope(domain.ScopeImagesWrite))
+		r.Use(middleware.RateLimitMiddleware(store, ImagePolicy, middleware.KeyByUser))
+		r.Use(middleware.IdempotencyMiddleware(idempotencyKeys))
 		r.Post("/", imageHandler.Store)
 	})
 }
 
-func ProductRoute(r chi.Router, db *sql.DB, validator *validator.Validate) {
-	productHandler := handler.NewProductHandler(db, validator)
+func ProductRoute(r chi.Router, db *sql.DB, validator *validator.Validate, store ratelimit.Store, sessions *session.Store, suggestions *suggest.Index, idempotencyKeys *idempotency.Store) {
+	productHandler := handler.NewProductHandler(db, validator, suggestions)
+	productVariantHandler := handler.NewProductVariantHandler(db, validator, suggestions)
+	productImageHandler := handler.NewProductImageHandler(db, validator)
+	inventoryHandler := handler.NewInventoryHandler(db, validator, suggestions)
+	productImportHandler := handler.NewProductImportHandler(db, validator, suggestions)
+	paymentHandler := handler.NewPaymentHandler(db, validator, suggestions)
+	reviewHandler := handler.NewReviewHandler(db, validator)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyKeys)
 	r.Route("/product", func(r chi.Router) {
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.JwtMiddleware)
-			r.Post("/", productHandler.Create)
+			r.Use(middleware.AuthMiddleware(db, sessions))
+			r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/", productHandler.Create)
+			r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/import", productImportHandler.Import)
+			r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Get("/import/{jobId}", productImportHandler.Show)
+			r.With(middleware.RequireScope(domain.ScopeProductsRead)).Get("/export", productImportHandler.Export)
+			r.With(middleware.RequireScope(domain.ScopeProductsRead)).Get("/archived", productHandler.Archived)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.OptionalJwtMiddleware(sessions))
+			r.Get("/", productHandler.Index)
+			r.Get("/suggest", productHandler.Suggest)
+		})
+
+		r.Route("/{productId}", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.OptionalJwtMiddleware(sessions))
+				r.Get("/", productHandler.Show)
+				r.Get("/variants", productVariantHandler.Index)
+				r.Get("/price-history", productHandler.PriceHistory)
+				r.Get("/reviews", reviewHandler.Index)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.AuthMiddleware(db, sessions))
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Patch("/", productHandler.Update)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Delete("/", productHandler.Delete)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/restore", productHandler.Restore)
+				r.With(middleware.RequireScope(domain.ScopeStockRead)).Get("/stock", productHandler.Stock)
+				r.With(middleware.RequireScope(domain.ScopeStockWrite), idempotent).Post("/stock", inventoryHandler.Adjust)
+				r.With(middleware.RequireScope(domain.ScopeStockRead)).Get("/stock/movements", inventoryHandler.Index)
 
-			r.Route("/{productId}", func(r chi.Router) {
-				r.Patch("/", productHandler.Update)
-				r.Delete("/", productHandler.Delete)
-				r.Get("/stock", productHandler.Stock)
+				r.With(
+					middleware.RequireScope(domain.ScopePaymentsWrite),
+					middleware.RateLimitMiddleware(store, BuyPolicy, middleware.KeyByUser),
+					idempotent,
+				).Post("/buy", paymentHandler.Create)
+				r.With(middleware.RequireScope(domain.ScopePaymentsRead), idempotent).Post("/buy/preview", paymentHandler.Preview)
 
-				paymentHandler := handler.NewPaymentHandler(db, validator)
-				r.Post("/buy", paymentHandler.Create)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/variants", productVariantHandler.Create)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Patch("/variants/{variantId}", productVariantHandler.Update)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Delete("/variants/{variantId}", productVariantHandler.Delete)
+
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/images", productImageHandler.Create)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Put("/images/order", productImageHandler.Order)
+				r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Delete("/images/{imageId}", productImageHandler.Delete)
 			})
 		})
+	})
+}
+
+func PaymentRoute(r chi.Router, db *sql.DB, validator *validator.Validate, sessions *session.Store, suggestions *suggest.Index, idempotencyKeys *idempotency.Store) {
+	paymentHandler := handler.NewPaymentHandler(db, validator, suggestions)
+	reviewHandler := handler.NewReviewHandler(db, validator)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyKeys)
+	r.Route("/payment", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, sessions))
+		r.With(middleware.RequireScope(domain.ScopePaymentsRead)).Get("/", paymentHandler.Index)
+		r.With(middleware.RequireScope(domain.ScopePaymentsRead)).Get("/sales", paymentHandler.Sales)
+		r.With(middleware.RequireScope(domain.ScopePaymentsWrite), idempotent).Post("/{paymentId}/ship", paymentHandler.Ship)
+		r.With(middleware.RequireScope(domain.ScopePaymentsWrite), idempotent).Post("/{paymentId}/receive", paymentHandler.Receive)
+		r.With(middleware.RequireScope(domain.ScopePaymentsWrite), idempotent).Post("/{paymentId}/review", reviewHandler.Create)
+	})
+}
+
+func ReviewRoute(r chi.Router, db *sql.DB, validator *validator.Validate, sessions *session.Store, idempotencyKeys *idempotency.Store) {
+	reviewHandler := handler.NewReviewHandler(db, validator)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyKeys)
+	r.Route("/review", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(db, sessions))
+			r.With(middleware.RequireScope(domain.ScopePaymentsWrite)).Patch("/{reviewId}", reviewHandler.Update)
+			r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/{reviewId}/reply", reviewHandler.Reply)
+			r.With(middleware.RequireScope(domain.ScopePaymentsWrite), idempotent).Post("/{reviewId}/report", reviewHandler.Report)
+		})
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Use(middleware.AdminMiddleware(db))
+			r.Use(middleware.IdempotencyMiddleware(idempotencyKeys))
+			r.Get("/", reviewHandler.Reported)
+			r.Post("/{reviewId}", reviewHandler.Moderate)
+		})
+	})
+}
+
+func CartRoute(r chi.Router, db *sql.DB, validator *validator.Validate, store ratelimit.Store, sessions *session.Store, suggestions *suggest.Index, idempotencyKeys *idempotency.Store) {
+	cartHandler := handler.NewCartHandler(db, validator, suggestions)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyKeys)
+	r.Route("/cart", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, sessions))
+		r.With(middleware.RequireScope(domain.ScopePaymentsRead)).Get("/", cartHandler.Index)
+		r.With(middleware.RequireScope(domain.ScopePaymentsWrite), idempotent).Post("/items", cartHandler.AddItem)
+		r.With(middleware.RequireScope(domain.ScopePaymentsWrite)).Patch("/items/{itemId}", cartHandler.UpdateItem)
+		r.With(middleware.RequireScope(domain.ScopePaymentsWrite)).Delete("/items/{itemId}", cartHandler.DeleteItem)
+		r.With(
+			middleware.RequireScope(domain.ScopePaymentsWrite),
+			middleware.RateLimitMiddleware(store, BuyPolicy, middleware.KeyByUser),
+			idempotent,
+		).Post("/checkout", cartHandler.Checkout)
+	})
+}
+
+func CouponRoute(r chi.Router, db *sql.DB, validator *validator.Validate, sessions *session.Store, idempotencyKeys *idempotency.Store) {
+	couponHandler := handler.NewCouponHandler(db, validator)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyKeys)
+	r.Route("/coupon", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(db, sessions))
+			r.With(middleware.RequireScope(domain.ScopeProductsRead)).Get("/", couponHandler.Index)
+			r.With(middleware.RequireScope(domain.ScopeProductsWrite), idempotent).Post("/", couponHandler.Create)
+			r.With(middleware.RequireScope(domain.ScopeProductsWrite)).Delete("/{couponId}", couponHandler.Delete)
+		})
+		r.Route("/platform", func(r chi.Router) {
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Use(middleware.AdminMiddleware(db))
+			r.Use(middleware.IdempotencyMiddleware(idempotencyKeys))
+			r.Get("/", couponHandler.PlatformIndex)
+			r.Post("/", couponHandler.PlatformCreate)
+			r.Delete("/{couponId}", couponHandler.PlatformDelete)
+		})
+	})
+}
+
+func CategoryRoute(r chi.Router, db *sql.DB, validator *validator.Validate, sessions *session.Store, idempotencyKeys *idempotency.Store) {
+	categoryHandler := handler.NewCategoryHandler(db, validator)
+	r.Route("/category", func(r chi.Router) {
+		r.Get("/", categoryHandler.Index)
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.OptionalJwtMiddleware)
-			r.Get("/", productHandler.Index)
-			r.Get("/{productId}", productHandler.Show)
+			r.Use(middleware.JwtMiddleware(sessions))
+			r.Use(middleware.AdminMiddleware(db))
+			r.Use(middleware.IdempotencyMiddleware(idempotencyKeys))
+			r.Post("/", categoryHandler.Create)
+			r.Patch("/{categoryId}", categoryHandler.Update)
+			r.Delete("/{categoryId}", categoryHandler.Delete)
 		})
 	})
 }
-func BankAccountRoute(r chi.Router, db *sql.DB, validator *validator.Validate) {
+
+func BankAccountRoute(r chi.Router, db *sql.DB, validator *validator.Validate, sessions *session.Store, idempotencyKeys *idempotency.Store) {
 	bankAccountHandler := handler.NewBankAccountHandler(db, validator)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyKeys)
 	r.Route("/bank/account", func(r chi.Router) {
-		r.Use(middleware.JwtMiddleware)
-		r.Get("/", bankAccountHandler.Index)
-		r.Post("/", bankAccountHandler.Create)
-		r.Patch("/{bankAccountId}", bankAccountHandler.Update)
-		r.Delete("/{bankAccountId}", bankAccountHandler.Delete)
+		r.Use(middleware.AuthMiddleware(db, sessions))
+		r.With(middleware.RequireScope(domain.ScopeBankAccountsRead)).Get("/", bankAccountHandler.Index)
+		r.With(middleware.RequireScope(domain.ScopeBankAccountsWrite), idempotent).Post("/", bankAccountHandler.Create)
+		r.With(middleware.RequireScope(domain.ScopeBankAccountsWrite)).Patch("/{bankAccountId}", bankAccountHandler.Update)
+		r.With(middleware.RequireScope(domain.ScopeBankAccountsWrite)).Delete("/{bankAccountId}", bankAccountHandler.Delete)
 	})
 }
@@ -0,0 +1,57 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const keyPrefix = "sfx_"
+
+// Generate returns a new plain key, the prefix used to look it up and the
+// hash to store. The key looks like sfx_<prefix>_<secret>.
+func Generate() (key string, prefix string, hash string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = keyPrefix + prefix + "_" + hex.EncodeToString(secretBytes)
+	return key, prefix, Hash(key), nil
+}
+
+// Parse returns the lookup prefix of a key.
+func Parse(key string) (string, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", fmt.Errorf("api key is invalid")
+	}
+	parts := strings.Split(strings.TrimPrefix(key, keyPrefix), "_")
+	if len(parts) != 2 || len(parts[0]) != 12 || len(parts[1]) != 64 {
+		return "", fmt.Errorf("api key is invalid")
+	}
+	return parts[0], nil
+}
+
+// IsApiKey reports whether the value has the shape of an api key rather than a jwt.
+func IsApiKey(value string) bool {
+	return strings.HasPrefix(value, keyPrefix)
+}
+
+// Hash hashes the key with sha256, keys are random enough that a slow hash
+// is not needed.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func Compare(key string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
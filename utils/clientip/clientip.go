@@ -0,0 +1,108 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	mu             sync.RWMutex
+	trustedProxies []*net.IPNet
+)
+
+// LoadTrustedProxies sets the proxies whose forwarding headers are trusted.
+// The value is a comma separated list of IPs or CIDRs, e.g. "10.0.0.0/8,127.0.0.1".
+func LoadTrustedProxies(value string) error {
+	nets := make([]*net.IPNet, 0)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy: %s", part)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			part = fmt.Sprintf("%s/%d", part, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	mu.Lock()
+	trustedProxies = nets
+	mu.Unlock()
+	return nil
+}
+
+// FromRequest returns the client IP of the request. Forwarding headers are
+// only honoured when the direct peer is a trusted proxy, and X-Forwarded-For
+// is walked from the right so a client cannot spoof its address.
+func FromRequest(r *http.Request) string {
+	remote := remoteHost(r.RemoteAddr)
+	if !isTrusted(remote) {
+		return remote
+	}
+
+	forwarded := make([]string, 0)
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(header, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				forwarded = append(forwarded, ip)
+			}
+		}
+	}
+
+	if len(forwarded) == 0 {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return remote
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if net.ParseIP(forwarded[i]) == nil {
+			// anything left of garbage cannot be trusted either
+			return remote
+		}
+		if !isTrusted(forwarded[i]) {
+			return forwarded[i]
+		}
+	}
+	return forwarded[0]
+}
+
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadTrustedProxies(t *testing.T) {
+	t.Cleanup(func() { LoadTrustedProxies("") })
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "", []string{}, false},
+		{"ipv4", "127.0.0.1", []string{"127.0.0.1/32"}, false},
+		{"ipv6", "::1", []string{"::1/128"}, false},
+		{"cidrs", "10.0.0.0/8, 192.168.1.0/24", []string{"10.0.0.0/8", "192.168.1.0/24"}, false},
+		{"cidr is masked", "10.1.2.3/8", []string{"10.0.0.0/8"}, false},
+		{"empty parts", "127.0.0.1,,", []string{"127.0.0.1/32"}, false},
+		{"invalid ip", "localhost", nil, true},
+		{"invalid cidr", "10.0.0.0/33", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := LoadTrustedProxies(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(trustedProxies) != len(tt.want) {
+				t.Fatalf("LoadTrustedProxies() = %v, want %v", trustedProxies, tt.want)
+			}
+			for i, ipNet := range trustedProxies {
+				if ipNet.String() != tt.want[i] {
+					t.Errorf("LoadTrustedProxies()[%d] = %s, want %s", i, ipNet, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTrustedProxiesKeepsProxiesOnError(t *testing.T) {
+	t.Cleanup(func() { LoadTrustedProxies("") })
+
+	if err := LoadTrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTrustedProxies("10.0.0.0/8,invalid"); err == nil {
+		t.Fatal("LoadTrustedProxies() error = nil, want an error")
+	}
+	if len(trustedProxies) != 1 {
+		t.Errorf("LoadTrustedProxies() replaced the proxies with %v on error", trustedProxies)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	if err := LoadTrustedProxies("10.0.0.0/8,::1"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { LoadTrustedProxies("") })
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"untrusted peer cannot forward", "203.0.113.7:5000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"ipv6 proxy", "[::1]:5000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed left entries are skipped", "10.0.0.1:5000", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:5000", []string{"198.51.100.1, 10.0.0.2, 10.0.0.3"}, "", "198.51.100.1"},
+		{"multiple headers", "10.0.0.1:5000", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"only trusted proxies", "10.0.0.1:5000", []string{"10.0.0.2, 10.0.0.3"}, "", "10.0.0.2"},
+		{"garbage stops the walk", "10.0.0.1:5000", []string{"198.51.100.1, garbage, 10.0.0.2"}, "", "10.0.0.1"},
+		{"real ip", "10.0.0.1:5000", nil, "198.51.100.1", "198.51.100.1"},
+		{"invalid real ip", "10.0.0.1:5000", nil, "garbage", "10.0.0.1"},
+		{"remote addr without port", "203.0.113.7", nil, "", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := FromRequest(r); got != tt.want {
+				t.Errorf("FromRequest() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package cursor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DirectionNext = "next"
+	DirectionPrev = "prev"
+)
+
+// Cursor points at a row of a keyset paginated listing. Values holds the sort
+// key values of the row, the last one being its id.
+type Cursor struct {
+	Sort      string            `json:"s"`
+	Values    []json.RawMessage `json:"v"`
+	Direction string            `json:"d"`
+}
+
+// Encode returns the cursor as an opaque, signed token.
+func Encode(c Cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(encoded), nil
+}
+
+// Decode verifies the signature of the token and returns its cursor.
+func Decode(token string) (Cursor, error) {
+	var c Cursor
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(sign(parts[0]))) {
+		return c, fmt.Errorf("cursor is invalid")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return c, fmt.Errorf("cursor is invalid")
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, fmt.Errorf("cursor is invalid")
+	}
+	if c.Direction != DirectionNext && c.Direction != DirectionPrev {
+		return c, fmt.Errorf("cursor is invalid")
+	}
+	return c, nil
+}
+
+// Args turns the cursor values into query arguments. Numbers are kept as
+// their text so they compare exactly against the column type.
+func (c Cursor) Args() ([]interface{}, error) {
+	args := make([]interface{}, 0, len(c.Values))
+	for _, raw := range c.Values {
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return nil, fmt.Errorf("cursor is invalid")
+		}
+		if n, ok := v.(json.Number); ok {
+			v = n.String()
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+func sign(payload string) string {
+	secret := os.Getenv("CURSOR_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,114 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	t.Setenv("CURSOR_SECRET", "cursor-secret")
+
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{"next", Cursor{Sort: "newest", Values: []json.RawMessage{json.RawMessage(`"2024-01-02T03:04:05Z"`), json.RawMessage(`"id"`)}, Direction: DirectionNext}},
+		{"prev", Cursor{Sort: "price", Values: []json.RawMessage{json.RawMessage(`1999`), json.RawMessage(`"id"`)}, Direction: DirectionPrev}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Encode(tt.cursor)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			got, err := Decode(token)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.cursor) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	t.Setenv("CURSOR_SECRET", "cursor-secret")
+
+	token, err := Encode(Cursor{Sort: "newest", Values: []json.RawMessage{json.RawMessage(`"id"`)}, Direction: DirectionNext})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+
+	// a payload re-signed with the right secret but an unknown direction
+	badDirection := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"newest","v":["id"],"d":"up"}`))
+	// a valid signature over a payload that is not json
+	notJson := base64.RawURLEncoding.EncodeToString([]byte(`not json`))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"missing signature", payload},
+		{"empty signature", payload + "."},
+		{"extra part", token + ".extra"},
+		{"tampered payload", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"newest","v":["other"],"d":"next"}`)) + "." + signature},
+		{"tampered signature", payload + "." + strings.Repeat("A", len(signature))},
+		{"unknown direction", badDirection + "." + sign(badDirection)},
+		{"invalid json", notJson + "." + sign(notJson)},
+		{"invalid base64", "!!!." + sign("!!!")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.token); err == nil {
+				t.Errorf("Decode(%q) error = nil, want an error", tt.token)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsOtherSecret(t *testing.T) {
+	t.Setenv("CURSOR_SECRET", "cursor-secret")
+	token, err := Encode(Cursor{Sort: "newest", Values: []json.RawMessage{json.RawMessage(`"id"`)}, Direction: DirectionNext})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CURSOR_SECRET", "rotated-secret")
+	if _, err := Decode(token); err == nil {
+		t.Errorf("Decode() error = nil, want an error for a token signed with another secret")
+	}
+}
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []json.RawMessage
+		want   []interface{}
+	}{
+		{"string", []json.RawMessage{json.RawMessage(`"id"`)}, []interface{}{"id"}},
+		{"integer keeps its text", []json.RawMessage{json.RawMessage(`12345678901234567890`), json.RawMessage(`"id"`)}, []interface{}{"12345678901234567890", "id"}},
+		{"decimal keeps its text", []json.RawMessage{json.RawMessage(`4.50`)}, []interface{}{"4.50"}},
+		{"null", []json.RawMessage{json.RawMessage(`null`)}, []interface{}{nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Cursor{Values: tt.values}.Args()
+			if err != nil {
+				t.Fatalf("Args() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TTL is how long a key is remembered, a key can be used for a new request
+// once it expired.
+const TTL = 24 * time.Hour
+
+// Lease is how long a request holds its key while it runs. A key left in
+// progress past its lease, e.g. by a crashed server, can be claimed again.
+const Lease = time.Minute
+
+var (
+	// ErrKeyReused is returned when a key is sent again for a different request.
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrInProgress is returned while the first request with the key runs.
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Response is the response of the first request with a key, replayed for
+// every retry.
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Fingerprint identifies a request by its method, request uri (the path and
+// query) and body.
+func Fingerprint(method string, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + uri + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin claims the key for the request, or takes over a key whose lease
+// expired. It returns a nil response when the request has to run, or the
+// response of the first request to replay.
+func (s *Store) Begin(userId string, key string, fingerprint string) (*Response, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO idempotency_keys (user_id, key, fingerprint) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, content_type = NULL, response_body = NULL, created_at = now()
+		WHERE idempotency_keys.created_at < now() - make_interval(secs => $4)
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < now() - make_interval(secs => $5))`,
+		userId, key, fingerprint, TTL.Seconds(), Lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if claimed, _ := res.RowsAffected(); claimed > 0 {
+		return nil, nil
+	}
+
+	var (
+		stored      string
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+		body        []byte
+	)
+	if err := s.db.QueryRow(
+		`SELECT fingerprint, status_code, content_type, response_body FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userId, key,
+	).Scan(&stored, &statusCode, &contentType, &body); err != nil {
+		return nil, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+
+	if stored != fingerprint {
+		return nil, ErrKeyReused
+	}
+	if !statusCode.Valid {
+		return nil, ErrInProgress
+	}
+	return &Response{StatusCode: int(statusCode.Int64), ContentType: contentType.String, Body: body}, nil
+}
+
+// Complete stores the response of the request that claimed the key.
+func (s *Store) Complete(userId string, key string, response Response) error {
+	if _, err := s.db.Exec(
+		`UPDATE idempotency_keys SET status_code = $1, content_type = $2, response_body = $3 WHERE user_id = $4 AND key = $5`,
+		response.StatusCode, response.ContentType, response.Body, userId, key,
+	); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release forgets the key so the request can be retried with it, e.g. after
+// the request failed on the server.
+func (s *Store) Release(userId string, key string) error {
+	if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userId, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes expired keys.
+func (s *Store) Purge() (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => $1)`, TTL.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PurgeEvery runs Purge on every tick of interval.
+func (s *Store) PurgeEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := s.Purge(); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
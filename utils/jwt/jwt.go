@@ -8,6 +8,11 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
+// TokenLifetime is how long an access token is valid. Its session lives
+// longer, see session.Lifetime.
+const TokenLifetime = 2 * time.Minute
+
+// Claim carries the session id as the standard jti claim.
 type Claim struct {
 	jwt.StandardClaims
 	UserId string `json:"user_id"`
@@ -21,14 +26,12 @@ type JWTToken struct {
 }
 
 func SignedToken(claim Claim) (string, error) {
-	exp := time.Now().Add(2 * time.Minute)
+	exp := time.Now().Add(TokenLifetime)
 	expAt := exp.Unix()
 	iat := time.Now().Unix()
 
-	claim.StandardClaims = jwt.StandardClaims{
-		ExpiresAt: expAt,
-		IssuedAt:  iat,
-	}
+	claim.StandardClaims.ExpiresAt = expAt
+	claim.StandardClaims.IssuedAt = iat
 	secretKey := os.Getenv("JWT_SECRET")
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
 
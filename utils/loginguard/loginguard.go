@@ -0,0 +1,251 @@
+package loginguard
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	failedAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shopifyx_login_failed_attempts_total",
+		Help: "Number of failed login attempts.",
+	}, []string{"scope"})
+
+	lockouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shopifyx_login_lockouts_total",
+		Help: "Number of temporary login lockouts.",
+	}, []string{"scope"})
+
+	rejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shopifyx_login_rejected_total",
+		Help: "Number of login requests rejected because of backoff or lockout.",
+	}, []string{"scope"})
+)
+
+const (
+	ScopeUsername = "username"
+	ScopeIP       = "ip"
+)
+
+type Config struct {
+	// FreeAttempts is the number of failures allowed before backoff kicks in.
+	FreeAttempts int
+	// BaseDelay is the first backoff delay, doubled on every further failure.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay.
+	MaxDelay time.Duration
+	// MaxAttempts is the number of failures that trigger a lockout.
+	MaxAttempts int
+	// LockoutDuration is how long a key stays locked.
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		MaxAttempts:     10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+}
+
+type Key struct {
+	Scope string
+	Value string
+}
+
+func Username(username string) Key {
+	return Key{Scope: ScopeUsername, Value: username}
+}
+
+func IP(ip string) Key {
+	return Key{Scope: ScopeIP, Value: ip}
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	blockedTill time.Time
+}
+
+// Guard tracks failed login attempts per key and decides when a key has to
+// wait before it may try again.
+type Guard struct {
+	mu      sync.Mutex
+	conf    Config
+	entries map[Key]*entry
+	// pending counts the attempts per key that are checking their password,
+	// keys leave it as soon as their attempts end.
+	pending   map[Key]int
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New(conf Config) *Guard {
+	return &Guard{
+		conf:    conf,
+		entries: make(map[Key]*entry),
+		pending: make(map[Key]int),
+		now:     time.Now,
+	}
+}
+
+// Attempt is a login attempt reserved by Begin, it has to be ended with Fail
+// or Done.
+type Attempt struct {
+	g     *Guard
+	keys  []Key
+	ended bool
+}
+
+// Begin reserves an attempt for the given keys. It returns how long the
+// caller has to wait before another attempt is allowed for any of them, the
+// attempt is only reserved when the wait is zero.
+//
+// Pending attempts count as failures until they end, so parallel attempts
+// cannot get past the backoff before their failures are recorded.
+func (g *Guard) Begin(keys ...Key) (*Attempt, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+
+	var wait time.Duration
+	for _, key := range keys {
+		// keys without failures have no entry, so unknown usernames cost
+		// nothing until they fail
+		var failures int
+		var remaining time.Duration
+		if e, ok := g.entries[key]; ok {
+			failures = e.failures
+			remaining = e.blockedTill.Sub(now)
+		}
+
+		// beyond the free attempts only one attempt runs at a time, the next
+		// one waits for the backoff of the pending one
+		pending := g.pending[key]
+		if attempts := failures + pending; pending > 0 && attempts >= g.conf.FreeAttempts {
+			if d := g.delay(attempts - g.conf.FreeAttempts); d > remaining {
+				remaining = d
+			}
+		}
+		if remaining <= 0 {
+			continue
+		}
+		rejected.WithLabelValues(key.Scope).Inc()
+		if remaining > wait {
+			wait = remaining
+		}
+	}
+	if wait > 0 {
+		return nil, wait
+	}
+
+	for _, key := range keys {
+		g.pending[key]++
+	}
+	return &Attempt{g: g, keys: keys}, 0
+}
+
+// Fail ends the attempt as a failed one for every key.
+func (a *Attempt) Fail() {
+	if a.ended {
+		return
+	}
+	a.ended = true
+
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for _, key := range a.keys {
+		g.release(key)
+
+		e, ok := g.entries[key]
+		if !ok || now.Sub(e.lastFailure) > g.conf.Window {
+			e = &entry{}
+			g.entries[key] = e
+		}
+		e.failures++
+		e.lastFailure = now
+		failedAttempts.WithLabelValues(key.Scope).Inc()
+
+		switch {
+		case e.failures >= g.conf.MaxAttempts:
+			e.blockedTill = now.Add(g.conf.LockoutDuration)
+			e.failures = 0
+			lockouts.WithLabelValues(key.Scope).Inc()
+		case e.failures > g.conf.FreeAttempts:
+			e.blockedTill = now.Add(g.delay(e.failures - g.conf.FreeAttempts))
+		}
+	}
+}
+
+// Done ends the attempt without recording a failure. It does nothing once the
+// attempt failed, so it can be deferred.
+func (a *Attempt) Done() {
+	if a.ended {
+		return
+	}
+	a.ended = true
+
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range a.keys {
+		g.release(key)
+	}
+}
+
+func (g *Guard) release(key Key) {
+	if g.pending[key] > 1 {
+		g.pending[key]--
+		return
+	}
+	delete(g.pending, key)
+}
+
+// Reset forgets every failure recorded for the given keys.
+func (g *Guard) Reset(keys ...Key) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		delete(g.entries, key)
+	}
+}
+
+func (g *Guard) delay(step int) time.Duration {
+	d := g.conf.BaseDelay
+	for i := 1; i < step; i++ {
+		d *= 2
+		if d >= g.conf.MaxDelay {
+			return g.conf.MaxDelay
+		}
+	}
+	return d
+}
+
+// sweep drops entries that are neither blocked nor inside the failure window.
+// It runs at most once per window so Begin stays cheap.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.conf.Window {
+		return
+	}
+	g.lastSweep = now
+	for key, e := range g.entries {
+		if now.After(e.blockedTill) && now.Sub(e.lastFailure) > g.conf.Window {
+			delete(g.entries, key)
+		}
+	}
+}
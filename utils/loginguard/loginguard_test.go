@@ -0,0 +1,217 @@
+package loginguard
+
+import (
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        4 * time.Second,
+	MaxAttempts:     8,
+	LockoutDuration: time.Minute,
+	Window:          10 * time.Minute,
+}
+
+// newTestGuard returns a guard whose clock only moves when advanced.
+func newTestGuard() (*Guard, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := New(testConfig)
+	g.now = func() time.Time { return now }
+	return g, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestDelay(t *testing.T) {
+	g := New(testConfig)
+
+	tests := []struct {
+		step int
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 4 * time.Second},
+		{50, 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := g.delay(tt.step); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+}
+
+const (
+	fail = "fail"
+	done = "done"
+)
+
+// guardStep advances the clock, begins an attempt expecting wait and, when it
+// may run, ends it with end.
+type guardStep struct {
+	advance time.Duration
+	wait    time.Duration
+	end     string
+}
+
+func TestBackoffAndLockout(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []guardStep
+	}{
+		{
+			name: "free attempts",
+			steps: []guardStep{
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, done},
+			},
+		},
+		{
+			name: "backoff doubles up to the max delay",
+			steps: []guardStep{
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, time.Second, ""},
+				{time.Second, 0, fail},
+				{0, 2 * time.Second, ""},
+				{time.Second, time.Second, ""},
+				{time.Second, 0, fail},
+				{0, 4 * time.Second, ""},
+				{4 * time.Second, 0, fail},
+				{0, 4 * time.Second, ""},
+			},
+		},
+		{
+			name: "lockout after max attempts",
+			steps: []guardStep{
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{time.Second, 0, fail},
+				{2 * time.Second, 0, fail},
+				{4 * time.Second, 0, fail},
+				{4 * time.Second, 0, fail},
+				{0, time.Minute, ""},
+				{30 * time.Second, 30 * time.Second, ""},
+				// the lockout starts the count over
+				{30 * time.Second, 0, fail},
+				{0, 0, done},
+			},
+		},
+		{
+			name: "failures are forgotten after the window",
+			steps: []guardStep{
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{0, 0, fail},
+				{testConfig.Window + time.Second, 0, fail},
+				{0, 0, done},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, advance := newTestGuard()
+			key := Username("alice")
+
+			for i, step := range tt.steps {
+				advance(step.advance)
+				attempt, wait := g.Begin(key)
+				if wait != step.wait {
+					t.Fatalf("step %d: Begin() wait = %v, want %v", i, wait, step.wait)
+				}
+				if (attempt == nil) != (wait > 0) {
+					t.Fatalf("step %d: Begin() attempt = %v with wait %v", i, attempt, wait)
+				}
+
+				switch step.end {
+				case fail:
+					attempt.Fail()
+				case done:
+					attempt.Done()
+				}
+			}
+		})
+	}
+}
+
+func TestBeginWaitsForEveryKey(t *testing.T) {
+	g, _ := newTestGuard()
+	username, ip := Username("alice"), IP("10.0.0.1")
+
+	for i := 0; i < testConfig.FreeAttempts+1; i++ {
+		attempt, _ := g.Begin(ip)
+		attempt.Fail()
+	}
+
+	if _, wait := g.Begin(username, ip); wait != time.Second {
+		t.Errorf("Begin() wait = %v, want the backoff of the ip", wait)
+	}
+	if attempt, wait := g.Begin(username); wait != 0 {
+		t.Errorf("Begin() wait = %v, want no wait for the username alone", wait)
+	} else {
+		attempt.Done()
+	}
+}
+
+func TestPendingAttempts(t *testing.T) {
+	g, _ := newTestGuard()
+	key := Username("alice")
+
+	// parallel attempts beyond the free ones wait for the pending ones
+	attempts := make([]*Attempt, 0)
+	for i := 0; i < testConfig.FreeAttempts; i++ {
+		attempt, wait := g.Begin(key)
+		if wait != 0 {
+			t.Fatalf("attempt %d: Begin() wait = %v, want 0", i, wait)
+		}
+		attempts = append(attempts, attempt)
+	}
+	if _, wait := g.Begin(key); wait != time.Second {
+		t.Fatalf("Begin() wait = %v, want %v while attempts are pending", wait, time.Second)
+	}
+
+	for _, attempt := range attempts {
+		attempt.Done()
+		// ending an attempt twice must not release it twice
+		attempt.Fail()
+	}
+	if len(g.pending) != 0 || len(g.entries) != 0 {
+		t.Errorf("guard keeps %d pending keys and %d entries, want none", len(g.pending), len(g.entries))
+	}
+}
+
+func TestResetAndSweep(t *testing.T) {
+	g, advance := newTestGuard()
+	alice, bob := Username("alice"), Username("bob")
+
+	for i := 0; i < testConfig.FreeAttempts+1; i++ {
+		attempt, _ := g.Begin(alice, bob)
+		attempt.Fail()
+	}
+
+	g.Reset(alice)
+	if _, ok := g.entries[alice]; ok {
+		t.Errorf("Reset() kept the entry of alice")
+	}
+	if _, ok := g.entries[bob]; !ok {
+		t.Errorf("Reset() dropped the entry of bob")
+	}
+
+	advance(testConfig.Window + time.Second)
+	attempt, _ := g.Begin(alice)
+	attempt.Done()
+	if len(g.entries) != 0 {
+		t.Errorf("sweep kept %d entries past the window, want none", len(g.entries))
+	}
+}
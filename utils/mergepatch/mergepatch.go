@@ -0,0 +1,40 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Apply applies an RFC 7396 JSON merge patch to the original document.
+func Apply(original []byte, patch []byte) ([]byte, error) {
+	var doc, p interface{}
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(merge(doc, p))
+}
+
+func merge(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = merge(targetObject[key], value)
+	}
+	return targetObject
+}
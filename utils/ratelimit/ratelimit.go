@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy describes a token bucket: Limit tokens that refill completely over
+// Period.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. MemoryStore is enough for a single instance, a
+// shared store (e.g. redis) has to implement this to limit across instances.
+type Store interface {
+	Take(key string, policy Policy) (Result, error)
+}
+
+// PolicyFromEnv overrides the default policy with an env value formatted as
+// "<limit>/<period>", e.g. "5/1h".
+func PolicyFromEnv(key string, def Policy) (Policy, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return def, fmt.Errorf("invalid rate limit %s: %s", key, value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit < 1 {
+		return def, fmt.Errorf("invalid rate limit %s: %s", key, value)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return def, fmt.Errorf("invalid rate limit %s: %s", key, value)
+	}
+
+	def.Limit = limit
+	def.Period = period
+	return def, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (ms *MemoryStore) Take(key string, policy Policy) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.now()
+	ms.sweep(now)
+
+	key = policy.Name + ":" + key
+	limit := float64(policy.Limit)
+	rate := limit / policy.Period.Seconds()
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit, last: now, period: policy.Period}
+		ms.buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: policy.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((limit - b.tokens) / rate)
+	return res, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (ms *MemoryStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < time.Minute {
+		return
+	}
+	ms.lastSweep = now
+	for key, b := range ms.buckets {
+		if now.Sub(b.last) > b.period {
+			delete(ms.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store whose clock only moves when advanced.
+func newTestStore() (*MemoryStore, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := NewMemoryStore()
+	ms.now = func() time.Time { return now }
+	return ms, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestTakeRefill(t *testing.T) {
+	// one token per second
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	ms, advance := newTestStore()
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    Result
+	}{
+		{"full bucket", 0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{"second token", 0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{"last token", 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{"empty bucket", 0, Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{"half a token", 500 * time.Millisecond, Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{"refilled token", 500 * time.Millisecond, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{"refill stops at the limit", 10 * time.Second, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	}
+
+	for _, tt := range tests {
+		advance(tt.advance)
+		got, err := ms.Take("10.0.0.1", policy)
+		if err != nil {
+			t.Fatalf("%s: Take() error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: Take() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTakeSeparatesBuckets(t *testing.T) {
+	login := Policy{Name: "login", Limit: 1, Period: time.Minute}
+	buy := Policy{Name: "buy", Limit: 1, Period: time.Minute}
+	ms, _ := newTestStore()
+
+	if res, _ := ms.Take("alice", login); !res.Allowed {
+		t.Fatalf("Take() denied the first request")
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		policy Policy
+		want   bool
+	}{
+		{"same key and policy", "alice", login, false},
+		{"other key", "bob", login, true},
+		{"other policy", "alice", buy, true},
+	}
+
+	for _, tt := range tests {
+		if res, _ := ms.Take(tt.key, tt.policy); res.Allowed != tt.want {
+			t.Errorf("%s: Take() allowed = %v, want %v", tt.name, res.Allowed, tt.want)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 1, Period: time.Minute}
+	ms, advance := newTestStore()
+
+	ms.Take("alice", policy)
+	advance(2 * time.Minute)
+	ms.Take("bob", policy)
+
+	if _, ok := ms.buckets["test:alice"]; ok {
+		t.Errorf("sweep kept the idle bucket")
+	}
+	if _, ok := ms.buckets["test:bob"]; !ok {
+		t.Errorf("sweep dropped the used bucket")
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	def := Policy{Name: "login", Limit: 20, Period: time.Minute}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    Policy
+		wantErr bool
+	}{
+		{"unset", "", def, false},
+		{"limit and period", "5/1h", Policy{Name: "login", Limit: 5, Period: time.Hour}, false},
+		{"spaces", " 5 / 30s ", Policy{Name: "login", Limit: 5, Period: 30 * time.Second}, false},
+		{"missing period", "5", def, true},
+		{"invalid limit", "five/1h", def, true},
+		{"zero limit", "0/1h", def, true},
+		{"invalid period", "5/hour", def, true},
+		{"negative period", "5/-1h", def, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RATE_LIMIT_TEST", tt.value)
+
+			got, err := PolicyFromEnv("RATE_LIMIT_TEST", def)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PolicyFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PolicyFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -37,7 +37,14 @@ func ClientUnauthorized() Error {
 func ClientInvalidCredential() Error {
 	return Error{
 		HttpStatus: http.StatusUnauthorized,
-		Message:    "email or password is incorect",
+		Message:    "username or password is incorrect",
+	}
+}
+
+func ClientTooManyRequests() Error {
+	return Error{
+		HttpStatus: http.StatusTooManyRequests,
+		Message:    "too many requests, please try again later",
 	}
 }
 
@@ -55,6 +62,20 @@ func ClientForbidden() Error {
 	}
 }
 
+func ClientNotAdmin() Error {
+	return Error{
+		HttpStatus: http.StatusForbidden,
+		Message:    "you are not an admin",
+	}
+}
+
+func ClientMissingScope(scope string) Error {
+	return Error{
+		HttpStatus: http.StatusForbidden,
+		Message:    "api key is missing the " + scope + " scope",
+	}
+}
+
 func ClientInvalidToken() Error {
 	return Error{
 		HttpStatus: http.StatusUnauthorized,
@@ -76,6 +97,34 @@ func ClientAlreadyExists() Error {
 	}
 }
 
+func ClientPreconditionFailed() Error {
+	return Error{
+		HttpStatus: http.StatusPreconditionFailed,
+		Message:    "resource has been modified, fetch it again before updating",
+	}
+}
+
+func ClientPreconditionRequired() Error {
+	return Error{
+		HttpStatus: http.StatusPreconditionRequired,
+		Message:    "If-Match header is required, fetch the resource for its ETag",
+	}
+}
+
+func ClientIdempotencyKeyReused() Error {
+	return Error{
+		HttpStatus: http.StatusUnprocessableEntity,
+		Message:    "idempotency key was already used for a different request",
+	}
+}
+
+func ClientIdempotencyKeyInProgress() Error {
+	return Error{
+		HttpStatus: http.StatusConflict,
+		Message:    "a request with this idempotency key is still in progress",
+	}
+}
+
 func ServerError() Error {
 	return Error{
 		HttpStatus: http.StatusInternalServerError,
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cacheTTL bounds how long a revocation made by another instance can go
+// unnoticed. Revocations made through this store are seen immediately.
+const cacheTTL = 30 * time.Second
+
+// Lifetime is how long a session stays valid without being refreshed, every
+// refresh extends it. Access tokens are much shorter lived, clients refresh
+// them with the refresh token of their session.
+const Lifetime = 7 * 24 * time.Hour
+
+type cached struct {
+	userId    string
+	active    bool
+	checkedAt time.Time
+}
+
+// Store creates sessions and answers whether a session is still active
+// without a database round trip on every request.
+type Store struct {
+	db        *sql.DB
+	mu        sync.Mutex
+	cache     map[string]cached
+	lastSweep time.Time
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db:    db,
+		cache: make(map[string]cached),
+	}
+}
+
+// Create starts a session for the user and returns its id and refresh token.
+func (s *Store) Create(userId string, userAgent string, ip string) (string, string, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	id := uuid.New()
+	date := time.Now()
+	if _, err := s.db.Exec(
+		`INSERT INTO sessions (id,user_id,user_agent,ip,created_at,last_seen_at,expires_at,refresh_token_hash) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		id, userId, userAgent, ip, date, date, date.Add(Lifetime), hashRefreshToken(refreshToken),
+	); err != nil {
+		return "", "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	s.set(id.String(), cached{userId: userId, active: true, checkedAt: date})
+	return id.String(), refreshToken, nil
+}
+
+// Refresh extends the session of the refresh token and rotates the token, so
+// every refresh token can be used once. It returns the session id, its user
+// and the new refresh token, or sql.ErrNoRows when the token belongs to no
+// active session.
+func (s *Store) Refresh(refreshToken string) (string, string, string, error) {
+	next, err := newRefreshToken()
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to refresh session: %w", err)
+	}
+
+	var id, userId string
+	date := time.Now()
+	if err := s.db.QueryRow(
+		`UPDATE sessions SET refresh_token_hash = $1, last_seen_at = $2, expires_at = $3 WHERE refresh_token_hash = $4 AND revoked_at IS NULL AND expires_at > $2 RETURNING id, user_id`,
+		hashRefreshToken(next), date, date.Add(Lifetime), hashRefreshToken(refreshToken),
+	).Scan(&id, &userId); err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", "", err
+		}
+		return "", "", "", fmt.Errorf("failed to refresh session: %w", err)
+	}
+
+	s.set(id, cached{userId: userId, active: true, checkedAt: date})
+	return id, userId, next, nil
+}
+
+// IsActive reports whether the session belongs to the user and is neither
+// revoked nor expired. Checking the database also refreshes last_seen_at.
+func (s *Store) IsActive(id string, userId string) (bool, error) {
+	s.mu.Lock()
+	c, ok := s.cache[id]
+	s.mu.Unlock()
+	if ok && time.Since(c.checkedAt) < cacheTTL {
+		return c.active && c.userId == userId, nil
+	}
+
+	var sessionUserId string
+	err := s.db.QueryRow(
+		`UPDATE sessions SET last_seen_at = $1 WHERE id = $2 AND revoked_at IS NULL AND expires_at > $1 RETURNING user_id`,
+		time.Now(), id,
+	).Scan(&sessionUserId)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+
+	active := err == nil
+	s.set(id, cached{userId: sessionUserId, active: active, checkedAt: time.Now()})
+	return active && sessionUserId == userId, nil
+}
+
+// Revoke revokes a session of the user. It returns sql.ErrNoRows when the
+// user has no such active session.
+func (s *Store) Revoke(id string, userId string) error {
+	res, err := s.db.Exec(
+		`UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`,
+		time.Now(), id, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	s.set(id, cached{userId: userId, active: false, checkedAt: time.Now()})
+	return nil
+}
+
+// RevokeAll revokes every session of the user.
+func (s *Store) RevokeAll(userId string) error {
+	if _, err := s.db.Exec(
+		`UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`,
+		time.Now(), userId,
+	); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.cache {
+		if entry.userId == userId {
+			entry.active = false
+			s.cache[key] = entry
+		}
+	}
+	return nil
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) set(id string, c cached) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastSweep) > cacheTTL {
+		s.lastSweep = time.Now()
+		for key, entry := range s.cache {
+			if time.Since(entry.checkedAt) > cacheTTL {
+				delete(s.cache, key)
+			}
+		}
+	}
+	s.cache[id] = c
+}
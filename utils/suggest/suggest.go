@@ -0,0 +1,307 @@
+package suggest
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	TypeProduct = "product"
+	TypeTag     = "tag"
+
+	// maxScan bounds the work done for short prefixes that match a large part
+	// of the catalogue.
+	maxScan = 2000
+)
+
+// Product is what the index needs to know about a product.
+type Product struct {
+	ID            string
+	Name          string
+	Tags          []string
+	PurchaseCount int64
+	// Eligible is false for products that are not purchasable or out of stock.
+	Eligible bool
+}
+
+type Suggestion struct {
+	Text      string `json:"text"`
+	Type      string `json:"type"`
+	ProductId string `json:"productId,omitempty"`
+}
+
+type term struct {
+	text     string
+	kind     string
+	products map[string]int64
+}
+
+func (t *term) score() int64 {
+	var score int64
+	for _, purchaseCount := range t.products {
+		score += 1 + purchaseCount
+	}
+	return score
+}
+
+// Index is an in memory prefix index over product names and tags. Every word
+// of a name is indexed, so "shoes" completes "Running Shoes" as well.
+type Index struct {
+	mu       sync.RWMutex
+	keys     []string
+	terms    map[string]*term
+	products map[string]Product
+	// loading appends keys unsorted, Load sorts them once at the end.
+	loading bool
+}
+
+func NewIndex() *Index {
+	return &Index{
+		terms:    make(map[string]*term),
+		products: make(map[string]Product),
+	}
+}
+
+// Load rebuilds the index from the products table.
+func (idx *Index) Load(db *sql.DB) error {
+	// only products listed right now are eligible, see the status of products
+	rows, err := db.Query(`SELECT id, name, tags, purchase_count, is_purchasable AND stock > 0
+		AND (status = 'published' OR (status = 'scheduled' AND publish_at <= now()))
+		AND (unpublish_at IS NULL OR unpublish_at > now())
+		FROM products WHERE deleted_at IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to load suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	fresh := NewIndex()
+	fresh.loading = true
+	for rows.Next() {
+		var (
+			p             Product
+			purchaseCount sql.NullInt64
+		)
+		if err := rows.Scan(&p.ID, &p.Name, pq.Array(&p.Tags), &purchaseCount, &p.Eligible); err != nil {
+			return fmt.Errorf("failed to load suggestions: %w", err)
+		}
+		p.PurchaseCount = purchaseCount.Int64
+		fresh.add(p)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load suggestions: %w", err)
+	}
+	fresh.sortKeys()
+
+	idx.mu.Lock()
+	idx.keys, idx.terms, idx.products = fresh.keys, fresh.terms, fresh.products
+	idx.mu.Unlock()
+	return nil
+}
+
+// RefreshEvery reloads the index periodically to pick up changes made
+// outside of this instance, e.g. purchases or other replicas.
+func (idx *Index) RefreshEvery(db *sql.DB, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := idx.Load(db); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
+
+func (idx *Index) Upsert(p Product) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(p.ID)
+	idx.add(p)
+}
+
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+// Suggest returns up to limit completions for the prefix, best first.
+func (idx *Index) Suggest(prefix string, limit int) []Suggestion {
+	prefix = normalize(prefix)
+	res := make([]Suggestion, 0, limit)
+	if prefix == "" || limit < 1 {
+		return res
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	type candidate struct {
+		term  *term
+		score int64
+	}
+	seen := make(map[*term]bool)
+	candidates := make([]candidate, 0)
+	start := sort.SearchStrings(idx.keys, prefix)
+	for i := start; i < len(idx.keys) && i-start < maxScan; i++ {
+		if !strings.HasPrefix(idx.keys[i], prefix) {
+			break
+		}
+		t, ok := idx.terms[termId(idx.keys[i])]
+		if ok && !seen[t] {
+			seen[t] = true
+			candidates = append(candidates, candidate{term: t, score: t.score()})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if len(candidates[i].term.text) != len(candidates[j].term.text) {
+			return len(candidates[i].term.text) < len(candidates[j].term.text)
+		}
+		return candidates[i].term.text < candidates[j].term.text
+	})
+
+	for _, c := range candidates {
+		if len(res) == limit {
+			break
+		}
+		s := Suggestion{Text: c.term.text, Type: c.term.kind}
+		if c.term.kind == TypeProduct && len(c.term.products) == 1 {
+			for id := range c.term.products {
+				s.ProductId = id
+			}
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func (idx *Index) add(p Product) {
+	idx.products[p.ID] = p
+	if !p.Eligible {
+		return
+	}
+
+	idx.addTerm(TypeProduct, p.Name, p.ID, p.PurchaseCount)
+	for _, tag := range p.Tags {
+		idx.addTerm(TypeTag, tag, p.ID, p.PurchaseCount)
+	}
+}
+
+func (idx *Index) remove(id string) {
+	p, ok := idx.products[id]
+	if !ok {
+		return
+	}
+	delete(idx.products, id)
+	if !p.Eligible {
+		return
+	}
+
+	idx.removeTerm(TypeProduct, p.Name, id)
+	for _, tag := range p.Tags {
+		idx.removeTerm(TypeTag, tag, id)
+	}
+}
+
+func (idx *Index) addTerm(kind string, text string, productId string, purchaseCount int64) {
+	text = strings.TrimSpace(text)
+	if normalize(text) == "" {
+		return
+	}
+	id := kind + "\x00" + normalize(text)
+
+	t, ok := idx.terms[id]
+	if !ok {
+		t = &term{text: text, kind: kind, products: make(map[string]int64)}
+		idx.terms[id] = t
+		if idx.loading {
+			idx.keys = append(idx.keys, keysOf(kind, text)...)
+		} else {
+			for _, key := range keysOf(kind, text) {
+				idx.insertKey(key)
+			}
+		}
+	}
+	t.products[productId] = purchaseCount
+}
+
+func (idx *Index) removeTerm(kind string, text string, productId string) {
+	text = strings.TrimSpace(text)
+	id := kind + "\x00" + normalize(text)
+
+	t, ok := idx.terms[id]
+	if !ok {
+		return
+	}
+	delete(t.products, productId)
+	if len(t.products) > 0 {
+		return
+	}
+
+	delete(idx.terms, id)
+	for _, key := range keysOf(kind, text) {
+		idx.deleteKey(key)
+	}
+}
+
+func (idx *Index) insertKey(key string) {
+	i := sort.SearchStrings(idx.keys, key)
+	if i < len(idx.keys) && idx.keys[i] == key {
+		return
+	}
+	idx.keys = append(idx.keys, "")
+	copy(idx.keys[i+1:], idx.keys[i:])
+	idx.keys[i] = key
+}
+
+// sortKeys sorts and dedupes the keys appended while loading.
+func (idx *Index) sortKeys() {
+	sort.Strings(idx.keys)
+	keys := idx.keys[:0]
+	for _, key := range idx.keys {
+		if len(keys) == 0 || keys[len(keys)-1] != key {
+			keys = append(keys, key)
+		}
+	}
+	idx.keys = keys
+	idx.loading = false
+}
+
+func (idx *Index) deleteKey(key string) {
+	i := sort.SearchStrings(idx.keys, key)
+	if i < len(idx.keys) && idx.keys[i] == key {
+		idx.keys = append(idx.keys[:i], idx.keys[i+1:]...)
+	}
+}
+
+// keysOf returns one "<word suffix>\x00<kind>\x00<text>" key per word of the
+// text, e.g. "red shoes" is found by both "red" and "shoes".
+func keysOf(kind string, text string) []string {
+	words := strings.Fields(normalize(text))
+	keys := make([]string, 0, len(words))
+	for i := range words {
+		keys = append(keys, strings.Join(words[i:], " ")+"\x00"+kind+"\x00"+normalize(text))
+	}
+	return keys
+}
+
+// termId strips the word suffix from a key, leaving "<kind>\x00<text>".
+func termId(key string) string {
+	parts := strings.SplitN(key, "\x00", 2)
+	if len(parts) != 2 {
+		return key
+	}
+	return parts[1]
+}
+
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
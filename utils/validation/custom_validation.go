@@ -25,6 +25,9 @@ func RegisterCustomValidation(v *validator.Validate) error {
 	if err := v.RegisterValidation("noSpace", validateNoSpace); err != nil {
 		return fmt.Errorf("failed to register username has space: %s", err)
 	}
+	if err := v.RegisterValidation("slug", validateSlug); err != nil {
+		return fmt.Errorf("failed to register slug validation: %s", err)
+	}
 
 	return nil
 }
@@ -82,6 +85,12 @@ func validateNoSpace(fl validator.FieldLevel) bool {
 	return !strings.Contains(field, " ")
 }
 
+var slugRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func validateSlug(fl validator.FieldLevel) bool {
+	return slugRegex.MatchString(fl.Field().String())
+}
+
 func UrlValidation(url string) error {
 	pattern := `^(https?|ftp):\/\/[^\s\/$.?#].[^\s]*$`
 